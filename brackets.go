@@ -0,0 +1,137 @@
+package main
+
+import "strings"
+
+// code_mask marks, for every row, the characters that are code rather than
+// part of a string or comment of the current language. Strings end at the
+// end of their line, block comments run on until they are closed.
+func code_mask() [][]bool {
+	lang := current_language()
+	commentStart, commentEnd := []rune(lang.blockComment[0]), []rune(lang.blockComment[1])
+	lineComment := []rune(lang.lineComment)
+	startsAt := func(line []rune, col int, marker []rune) bool {
+		if len(marker) == 0 || col+len(marker) > len(line) {
+			return false
+		}
+		for i, r := range marker {
+			if line[col+i] != r {
+				return false
+			}
+		}
+		return true
+	}
+	mask := make([][]bool, len(text_buffer))
+	inComment := false
+	for row, line := range text_buffer {
+		mask[row] = make([]bool, len(line))
+		var quote rune
+		for col := 0; col < len(line); col++ {
+			switch {
+			case inComment:
+				if startsAt(line, col, commentEnd) {
+					col += len(commentEnd) - 1
+					inComment = false
+				}
+			case quote != 0:
+				if line[col] == '\\' {
+					col++
+				} else if line[col] == quote {
+					quote = 0
+				}
+			case startsAt(line, col, commentStart):
+				col += len(commentStart) - 1
+				inComment = true
+			case startsAt(line, col, lineComment):
+				col = len(line)
+			case strings.ContainsRune(lang.quotes, line[col]):
+				quote = line[col]
+			default:
+				mask[row][col] = true
+			}
+		}
+	}
+	return mask
+}
+
+// bracket_pairs pairs up the brackets in the code of the buffer, skipping
+// strings and comments. Every bracket found maps to its partner, or to
+// itself when it is unbalanced.
+func bracket_pairs() map[position]position {
+	pairs := map[position]position{}
+	stack := []position{}
+	for row, rowMask := range code_mask() {
+		for col, isCode := range rowMask {
+			ch := text_buffer[row][col]
+			if !isCode || !strings.ContainsRune("()[]{}", ch) {
+				continue
+			}
+			p := position{row, col}
+			pairs[p] = p
+			if open := opening_bracket(ch); open == 0 {
+				stack = append(stack, p)
+			} else if len(stack) > 0 && char_at(stack[len(stack)-1]) == open {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				pairs[top], pairs[p] = p, top
+			}
+		}
+	}
+	return pairs
+}
+
+// bracketMatches holds bracket_pairs for the buffer as it was at change
+// bracketMatchesChange, so redraws only scan the buffer again after it
+// changes, and cursorBrackets the bracket at the cursor and its partner,
+// which are highlighted.
+var (
+	bracketMatches       map[position]position
+	bracketMatchesChange int
+	cursorBrackets       []position
+)
+
+// matching_brackets returns bracket_pairs for the buffer, scanning it again
+// only when it has changed since the last time.
+func matching_brackets() map[position]position {
+	if bracketMatches == nil || bracketMatchesChange != changeCount {
+		bracketMatches = bracket_pairs()
+		bracketMatchesChange = changeCount
+	}
+	return bracketMatches
+}
+
+// forget_bracket_matches drops the brackets matched so far, for when the
+// buffer changes without a change being counted, as on undo.
+func forget_bracket_matches() {
+	bracketMatches = nil
+}
+
+// update_bracket_matches finds the brackets to highlight: the one under the
+// cursor, or else the one just before it, with its partner.
+func update_bracket_matches() {
+	matching_brackets()
+	cursorBrackets = nil
+	for _, p := range []position{cursor(), {currentRow, currentCol - 1}} {
+		if partner, found := bracketMatches[p]; found && partner != p {
+			cursorBrackets = []position{p, partner}
+			return
+		}
+	}
+}
+
+// bracket_highlight reports how to draw the character at p: whether it is
+// an unbalanced bracket or one of the pair at the cursor.
+func bracket_highlight(p position) (unbalanced bool, matched bool) {
+	partner, found := bracketMatches[p]
+	if !found {
+		return false, false
+	}
+	if partner == p {
+		return true, false
+	}
+	for _, bracket := range cursorBrackets {
+		if bracket == p {
+			return false, true
+		}
+	}
+	return false, false
+}
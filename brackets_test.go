@@ -0,0 +1,77 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBracketPairs(t *testing.T) {
+	saved := file_extension
+	defer func() { file_extension = saved }()
+	tests := []struct {
+		extension string
+		lines     []string
+		want      map[position]position
+	}{
+		{"go", []string{"f(a[1])"}, map[position]position{
+			{0, 1}: {0, 6}, {0, 6}: {0, 1}, {0, 3}: {0, 5}, {0, 5}: {0, 3},
+		}},
+		{"go", []string{"{", "}"}, map[position]position{{0, 0}: {1, 0}, {1, 0}: {0, 0}}},
+		{"go", []string{`f(")") // )`}, map[position]position{{0, 1}: {0, 5}, {0, 5}: {0, 1}}},
+		{"go", []string{"(/* ) */", ")"}, map[position]position{{0, 0}: {1, 0}, {1, 0}: {0, 0}}},
+		{"go", []string{"(]"}, map[position]position{{0, 0}: {0, 0}, {0, 1}: {0, 1}}},
+		{"py", []string{"x = ( # )"}, map[position]position{{0, 4}: {0, 4}}},
+		{"html", []string{"<!-- ( -->)"}, map[position]position{{0, 10}: {0, 10}}},
+	}
+	for _, test := range tests {
+		file_extension = test.extension
+		set_buffer(test.lines...)
+		if got := bracket_pairs(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("bracket_pairs of %q = %v, want %v", test.lines, got, test.want)
+		}
+	}
+}
+
+func TestMatchBracketMotion(t *testing.T) {
+	saved := file_extension
+	defer func() { file_extension = saved }()
+	file_extension = "go"
+	tests := []struct {
+		lines []string
+		keys  string
+		want  position
+	}{
+		{[]string{"f(a, \")\",", "  b)"}, "%", position{1, 3}},
+		{[]string{"f(a, \")\",", "  b)"}, "j$h%", position{0, 1}},
+		{[]string{"x := a[i] // (", "y"}, "%", position{0, 8}},
+		{[]string{"(("}, "%", position{0, 0}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		run_keys(t, test.keys)
+		if got := cursor(); got != test.want {
+			t.Errorf("%q on %q moved to %v, want %v", test.keys, test.lines, got, test.want)
+		}
+	}
+}
+
+func TestBracketHighlight(t *testing.T) {
+	saved := file_extension
+	defer func() { file_extension = saved }()
+	file_extension = "go"
+	set_buffer("f(x) ]")
+	currentCol = 4
+	update_bracket_matches()
+	for col, want := range [][2]bool{{false, false}, {false, true}, {false, false}, {false, true}, {false, false}, {true, false}} {
+		unbalanced, matched := bracket_highlight(position{0, col})
+		if got := [2]bool{unbalanced, matched}; got != want {
+			t.Errorf("bracket_highlight at %d = %v, want %v", col, got, want)
+		}
+	}
+	run_keys(t, "i]\x1b")
+	matching_brackets()
+	run_keys(t, "u")
+	if got := matching_brackets(); !reflect.DeepEqual(got, map[position]position{{0, 1}: {0, 3}, {0, 3}: {0, 1}, {0, 5}: {0, 5}}) {
+		t.Errorf("brackets after undo = %v", got)
+	}
+}
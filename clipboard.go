@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/atotto/clipboard"
+)
+
+// clipboard_provider is one way of reaching the system clipboard. read is
+// nil for providers that can only copy.
+type clipboard_provider struct {
+	name      string
+	available func() bool
+	read      func() (string, error)
+	write     func(text string) error
+}
+
+// clipboardProviders are tried in this order when the clipboard option is
+// "auto". The internal provider only keeps the text inside the editor, so
+// it always works and comes last.
+var clipboardProviders = []clipboard_provider{
+	{
+		name:      "native",
+		available: func() bool { return !clipboard.Unsupported },
+		read:      clipboard.ReadAll,
+		write:     clipboard.WriteAll,
+	},
+	{
+		name: "tmux",
+		available: func() bool {
+			_, err := exec.LookPath("tmux")
+			return os.Getenv("TMUX") != "" && err == nil
+		},
+		read: func() (string, error) {
+			out, err := exec.Command("tmux", "save-buffer", "-").Output()
+			return string(out), err
+		},
+		write: func(text string) error {
+			cmd := exec.Command("tmux", "load-buffer", "-")
+			cmd.Stdin = strings.NewReader(text)
+			return cmd.Run()
+		},
+	},
+	{
+		name:      "osc52",
+		available: func() bool { return os.Getenv("TERM") != "" && os.Getenv("TERM") != "dumb" },
+		write:     write_osc52,
+	},
+	{
+		name:      "internal",
+		available: func() bool { return true },
+		read:      func() (string, error) { return clipboardText, nil },
+		write:     func(text string) error { return nil },
+	},
+}
+
+// clipboardNotice is the last fallback reported in the status bar, so each
+// one is only reported once.
+var clipboardNotice string
+
+// write_osc52 asks the terminal to copy text with the OSC 52 escape
+// sequence, which also reaches the local clipboard over SSH. The terminal
+// gives no answer, so this can't tell whether it worked.
+func write_osc52(text string) error {
+	_, err := fmt.Fprintf(os.Stdout, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return err
+}
+
+func find_clipboard_provider(name string) *clipboard_provider {
+	for i := range clipboardProviders {
+		if clipboardProviders[i].name == name {
+			return &clipboardProviders[i]
+		}
+	}
+	return nil
+}
+
+// clipboard_candidates lists the providers to try, best first: the one the
+// clipboard option names, or every available one for "auto", followed by
+// the internal one.
+func clipboard_candidates() []*clipboard_provider {
+	if provider := find_clipboard_provider(options.clipboard); provider != nil {
+		return []*clipboard_provider{provider, find_clipboard_provider("internal")}
+	}
+	candidates := []*clipboard_provider{}
+	for i := range clipboardProviders {
+		if clipboardProviders[i].available() {
+			candidates = append(candidates, &clipboardProviders[i])
+		}
+	}
+	return candidates
+}
+
+// copy_to_clipboard puts text on the clipboard with the first provider
+// that takes it. When that isn't the first choice, the status bar says
+// which one was used and why.
+func copy_to_clipboard(text string) {
+	reasons := []string{}
+	if options.clipboard == "auto" && clipboard.Unsupported {
+		reasons = append(reasons, "no clipboard tool found")
+	}
+	for _, provider := range clipboard_candidates() {
+		err := provider.write(text)
+		if err != nil {
+			reasons = append(reasons, provider.name+": "+err.Error())
+			continue
+		}
+		if len(reasons) > 0 {
+			notice := "Copied with " + provider.name + " clipboard (" + strings.Join(reasons, ", ") + ")"
+			if notice != clipboardNotice {
+				statusMessage = notice
+				clipboardNotice = notice
+			}
+		}
+		return
+	}
+}
+
+// read_clipboard returns the clipboard contents from the first provider
+// that can read them.
+func read_clipboard() (string, error) {
+	for _, provider := range clipboard_candidates() {
+		if provider.read == nil {
+			continue
+		}
+		if text, err := provider.read(); err == nil {
+			return text, nil
+		}
+	}
+	return "", errors.New("clipboard can't be read")
+}
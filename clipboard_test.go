@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// keep_clipboard restores the clipboard providers and text when the test
+// ends.
+func keep_clipboard(t *testing.T) {
+	keep_options(t)
+	providers, text, notice := clipboardProviders, clipboardText, clipboardNotice
+	t.Cleanup(func() { clipboardProviders, clipboardText, clipboardNotice = providers, text, notice })
+}
+
+func TestClipboardOption(t *testing.T) {
+	keep_options(t)
+	for _, arg := range []string{"clipboard=auto", "cb=tmux", "cb=internal"} {
+		if err := set_option(arg); err != nil {
+			t.Errorf("set %s: %v", arg, err)
+		}
+	}
+	if err := set_option("clipboard=xsel"); err == nil {
+		t.Errorf("set clipboard=xsel: no error")
+	}
+	if got := clipboard_candidates(); len(got) != 2 || got[0].name != "internal" || got[1].name != "internal" {
+		t.Errorf("candidates for internal = %v", got)
+	}
+}
+
+func TestClipboardFallback(t *testing.T) {
+	keep_clipboard(t)
+	broken := clipboard_provider{
+		name:      "broken",
+		available: func() bool { return true },
+		read:      func() (string, error) { return "", errors.New("no display") },
+		write:     func(text string) error { return errors.New("no display") },
+	}
+	clipboardProviders = []clipboard_provider{broken, *find_clipboard_provider("internal")}
+	options.clipboard = "broken"
+	statusMessage, clipboardNotice = "", ""
+	write_to_clipboard([]rune("text"))
+	if want := "Copied with internal clipboard (broken: no display)"; statusMessage != want {
+		t.Errorf("status after a failed copy = %q, want %q", statusMessage, want)
+	}
+	statusMessage = ""
+	write_to_clipboard([]rune("more"))
+	if statusMessage != "" {
+		t.Errorf("second failed copy reported %q again", statusMessage)
+	}
+	if text, err := read_clipboard(); text != "more" || err != nil {
+		t.Errorf("read_clipboard() = %q, %v", text, err)
+	}
+}
+
+func TestInternalClipboard(t *testing.T) {
+	keep_clipboard(t)
+	options.clipboard = "internal"
+	set_buffer("one", "two")
+	registers = map[rune]register{}
+	run_keys(t, `"+yyj"+p`)
+	if got, want := buffer_lines(), []string{"one", "two", "one"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`"+yy then "+p = %q, want %q`, got, want)
+	}
+}
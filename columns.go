@@ -0,0 +1,80 @@
+package main
+
+import "github.com/mattn/go-runewidth"
+
+// cluster_width returns the number of screen cells taken by the grapheme
+// cluster line[start:end] when it starts at visual column vcol. Tabs stretch
+// to the next tab stop, control characters are shown as ^X, and a cluster
+// takes the width of its base rune.
+func cluster_width(line []rune, start, end int, vcol int) int {
+	r := line[start]
+	switch {
+	case r == '\t':
+		return options.tabWidth - vcol%options.tabWidth
+	case is_control(r):
+		return 2
+	case is_regional_indicator(r) && end-start == 2:
+		return 2
+	}
+	if width := runewidth.RuneWidth(r); width > 0 {
+		return width
+	}
+	// A combining mark with nothing to combine with is drawn on its own
+	return 1
+}
+
+func is_control(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
+
+// visual_col returns the screen column (relative to the start of the text
+// area, ignoring offsetCol) at which column col of line starts.
+func visual_col(line []rune, col int) int {
+	vcol := 0
+	for i := 0; i < col && i < len(line); {
+		end := grapheme_end(line, i)
+		vcol += cluster_width(line, i, end, vcol)
+		i = end
+	}
+	return vcol
+}
+
+// col_from_visual is the inverse of visual_col: it returns the column of the
+// grapheme cluster covering screen column vcol, or len(line) when vcol is
+// past the end.
+func col_from_visual(line []rune, vcol int) int {
+	current := 0
+	for i := 0; i < len(line); {
+		end := grapheme_end(line, i)
+		width := cluster_width(line, i, end, current)
+		if vcol < current+width {
+			return i
+		}
+		current += width
+		i = end
+	}
+	return len(line)
+}
+
+// cursor_width returns the number of cells the cursor covers at col, which is
+// the width of the character under it or 1 at the end of the line.
+func cursor_width(line []rune, col int) int {
+	if col >= len(line) {
+		return 1
+	}
+	return cluster_width(line, col, grapheme_end(line, col), visual_col(line, col))
+}
+
+// move_rows moves the cursor delta rows up or down, keeping it as close to
+// preferredCol as the target line allows.
+func move_rows(delta int) {
+	currentRow += delta
+	if currentRow > len(text_buffer)-1 {
+		currentRow = len(text_buffer) - 1
+	}
+	if currentRow < 0 {
+		currentRow = 0
+	}
+	currentCol = col_from_visual(text_buffer[currentRow], preferredCol)
+	keepPreferredCol = true
+}
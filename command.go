@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// command_line reads an ex-style command after ':' on the status line,
+// starting with the text command, and runs it when Enter is pressed.
+func command_line(command string) {
+	mode = 5
+
+	for {
+		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+		update_size()
+		display_text_buffer()
+		print_message(0, ROWS, termbox.ColorWhite, termbox.ColorDefault, ":"+command)
+		termbox.SetCursor(len(":")+runewidth.StringWidth(command), ROWS)
+		termbox.Flush()
+
+		ev := get_key()
+		switch ev.Type {
+		case termbox.EventKey:
+			switch ev.Key {
+			case termbox.KeyEsc:
+				mode = 0
+				return
+			case termbox.KeyEnter:
+				mode = 0
+				if err := run_command(command); err != nil {
+					statusMessage = err.Error()
+				}
+				return
+			case termbox.KeyBackspace, termbox.KeyBackspace2:
+				if len(command) == 0 {
+					mode = 0
+					return
+				}
+				runes := []rune(command)
+				command = string(runes[:prev_grapheme(runes, len(runes))])
+			case termbox.KeySpace:
+				command += " "
+			case keyPaste:
+				command += pasted_line(ev)
+			default:
+				if ev.Ch != 0 {
+					command += string(ev.Ch)
+				}
+			}
+		}
+	}
+}
+
+// run_command executes a single command line, as typed after ':' or read
+// from the config file.
+func run_command(command string) error {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return nil
+	}
+
+	first, last, command, hasRange, err := parse_range(command)
+	if err != nil {
+		return err
+	}
+	if command == "" {
+		record_jump()
+		lineNumber := last + 1
+		jumpToLine(&lineNumber)
+		return nil
+	}
+	name, args := command_name(command)
+	if !hasRange {
+		first, last = currentRow, currentRow
+		switch name {
+		case "sort", "sort!", "sor", "sor!", "uniq", "uni":
+			first, last = 0, len(text_buffer)-1
+		case "j", "j!", "join", "join!":
+			last = min(currentRow+1, len(text_buffer)-1)
+		}
+	}
+
+	switch name {
+	case "sort", "sor", "sort!", "sor!":
+		return sort_lines(first, last, args, strings.HasSuffix(name, "!"))
+	case "uniq", "uni":
+		uniq_lines(first, last, strings.TrimSpace(args) == "i")
+		return nil
+	case "j", "join", "j!", "join!":
+		join_lines(first, max(last, first+1), !strings.HasSuffix(name, "!"))
+		return nil
+	case "t", "co", "copy", "m", "move":
+		target, rest, ok, err := parse_address(strings.TrimSpace(args))
+		if err != nil || !ok || strings.TrimSpace(rest) != "" || target < -1 || target >= len(text_buffer) {
+			return fmt.Errorf("invalid address: %s", args)
+		}
+		if name == "t" || name == "co" || name == "copy" {
+			lines := copy_rows(first, last)
+			push_buffer()
+			insert_lines(target+1, lines)
+			currentRow, currentCol = target+len(lines), 0
+			modified = 0
+			return nil
+		}
+		// The cursor ends up on the last line moved
+		switch {
+		case target >= last:
+			move_lines(first, last, target-last)
+			currentRow = target
+		case target < first:
+			move_lines(first, last, target+1-first)
+			currentRow = target + 1 + last - first
+		default:
+			return fmt.Errorf("cannot move lines into themselves")
+		}
+		currentCol = first_non_blank(currentRow)
+		return nil
+	}
+
+	if hasRange {
+		return fmt.Errorf("no range allowed: %s", command)
+	}
+	switch name {
+	case "w", "write":
+		write_file(source_file)
+		return nil
+	case "q", "quit":
+		handle_close()
+		return nil
+	case "q!", "quit!":
+		exit_editor()
+		return nil
+	case "wq", "x", "xit":
+		write_file(source_file)
+		exit_editor()
+		return nil
+	case "registers", "reg", "display", "di":
+		show_registers()
+		return nil
+	case "set", "se":
+		for _, arg := range split_args(args) {
+			if err := set_option(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("not an editor command: %s", command)
+	}
+}
+
+// command_name splits a command into its name, which is letters and an
+// optional '!', and its arguments, so that :t. and :sort! n both work.
+func command_name(command string) (string, string) {
+	end := strings.IndexFunc(command, func(r rune) bool { return !unicode.IsLetter(r) })
+	if end < 0 {
+		return command, ""
+	}
+	if end == 0 {
+		name, args, _ := strings.Cut(command, " ")
+		return name, args
+	}
+	if command[end] == '!' {
+		end++
+	}
+	return command[:end], strings.TrimSpace(command[end:])
+}
+
+// parse_range reads the range in front of an ex command: % for the whole
+// buffer, or one or two line addresses separated by a comma. It returns
+// the rows, the rest of the command and whether there was a range.
+func parse_range(command string) (int, int, string, bool, error) {
+	if rest, found := strings.CutPrefix(command, "%"); found {
+		return 0, len(text_buffer) - 1, strings.TrimSpace(rest), true, nil
+	}
+	first, rest, ok, err := parse_address(command)
+	if err != nil || !ok {
+		return currentRow, currentRow, command, false, err
+	}
+	last := first
+	if after, found := strings.CutPrefix(rest, ","); found {
+		if last, rest, ok, err = parse_address(after); err != nil {
+			return 0, 0, "", false, err
+		} else if !ok {
+			return 0, 0, "", false, fmt.Errorf("invalid range: %s", command)
+		}
+	}
+	if first > last {
+		first, last = last, first
+	}
+	if first < 0 || last >= len(text_buffer) {
+		return 0, 0, "", false, fmt.Errorf("invalid range: %s", command)
+	}
+	return first, last, strings.TrimSpace(rest), true, nil
+}
+
+// parse_address reads a line address from the start of text and returns
+// its row, with the text after it. An address is a line number (0 being
+// the row before the first), . for the cursor line, $ for the last line
+// or 'x for the line of mark x, where '< and '> are the first and last
+// line of the last selection, followed by any +N and -N offsets. ok is
+// false when text doesn't start with an address.
+func parse_address(text string) (int, string, bool, error) {
+	row := currentRow
+	switch {
+	case text == "":
+		return 0, text, false, nil
+	case text[0] == '.':
+		text = text[1:]
+	case text[0] == '$':
+		row, text = len(text_buffer)-1, text[1:]
+	case text[0] >= '0' && text[0] <= '9':
+		end := strings.IndexFunc(text, func(r rune) bool { return r < '0' || r > '9' })
+		if end < 0 {
+			end = len(text)
+		}
+		number, _ := strconv.Atoi(text[:end])
+		row, text = number-1, text[end:]
+	case text[0] == '\'' && len(text) > 1:
+		name := rune(text[1])
+		if name == '<' || name == '>' {
+			if !lastVisual.saved {
+				return 0, text, false, fmt.Errorf("no previous selection")
+			}
+			row = min(lastVisual.start.row, lastVisual.end.row)
+			if name == '>' {
+				row = max(lastVisual.start.row, lastVisual.end.row)
+			}
+		} else if p, found := marks[name]; found {
+			row = p.row
+		} else {
+			return 0, text, false, fmt.Errorf("mark not set: %c", name)
+		}
+		text = text[2:]
+	case text[0] != '+' && text[0] != '-':
+		return 0, text, false, nil
+	}
+	for len(text) > 0 && (text[0] == '+' || text[0] == '-') {
+		sign := 1
+		if text[0] == '-' {
+			sign = -1
+		}
+		end := strings.IndexFunc(text[1:], func(r rune) bool { return r < '0' || r > '9' }) + 1
+		if end == 0 {
+			end = len(text)
+		}
+		offset := 1
+		if end > 1 {
+			offset, _ = strconv.Atoi(text[1:end])
+		}
+		row, text = row+sign*offset, text[end:]
+	}
+	return row, text, true, nil
+}
+
+// split_args splits a command's arguments on whitespace, where a backslash
+// escapes the character after it so values can contain spaces.
+func split_args(args string) []string {
+	var fields []string
+	var field strings.Builder
+	inField, escaped := false, false
+	for _, r := range args {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, inField = true, true
+		case r == ' ' || r == '\t':
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	set_buffer("1", "2", "3", "4", "5", "6", "7", "8", "9", "10")
+	currentRow = 4
+	marks['a'] = position{2, 0}
+	tests := []struct {
+		text string
+		row  int
+		rest string
+		ok   bool
+	}{
+		{"", 0, "", false},
+		{"sort", 0, "sort", false},
+		{".", 4, "", true},
+		{"$", 9, "", true},
+		{"3", 2, "", true},
+		{"12d", 11, "d", true},
+		{"0", -1, "", true},
+		{"+3", 7, "", true},
+		{"-3", 1, "", true},
+		{"+", 5, "", true},
+		{"-", 3, "", true},
+		{".+2", 6, "", true},
+		{"$-1", 8, "", true},
+		{"3+1-2", 1, "", true},
+		{"'a", 2, "", true},
+		{"'a+1,$", 3, ",$", true},
+	}
+	for _, test := range tests {
+		row, rest, ok, err := parse_address(test.text)
+		if err != nil {
+			t.Errorf("parse_address(%q): %v", test.text, err)
+			continue
+		}
+		if ok != test.ok || ok && (row != test.row || rest != test.rest) {
+			t.Errorf("parse_address(%q) = %d, %q, %v, want %d, %q, %v", test.text, row, rest, ok, test.row, test.rest, test.ok)
+		}
+	}
+	for _, text := range []string{"'b", "'<"} {
+		lastVisual.saved = false
+		if _, _, _, err := parse_address(text); err == nil {
+			t.Errorf("parse_address(%q): no error", text)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	set_buffer("1", "2", "3", "4", "5")
+	currentRow = 1
+	tests := []struct {
+		command     string
+		first, last int
+		rest        string
+		hasRange    bool
+	}{
+		{"sort", 1, 1, "sort", false},
+		{"%sort", 0, 4, "sort", true},
+		{"3", 2, 2, "", true},
+		{"+2", 3, 3, "", true},
+		{"2,4d", 1, 3, "d", true},
+		{"4,2 j", 1, 3, "j", true},
+		{".,$m0", 1, 4, "m0", true},
+		{".,.+1", 1, 2, "", true},
+	}
+	for _, test := range tests {
+		first, last, rest, hasRange, err := parse_range(test.command)
+		if err != nil {
+			t.Errorf("parse_range(%q): %v", test.command, err)
+			continue
+		}
+		if first != test.first || last != test.last || rest != test.rest || hasRange != test.hasRange {
+			t.Errorf("parse_range(%q) = %d, %d, %q, %v, want %d, %d, %q, %v", test.command,
+				first, last, rest, hasRange, test.first, test.last, test.rest, test.hasRange)
+		}
+	}
+	for _, command := range []string{"9", "0", "1,", "2,9d", "-5"} {
+		if _, _, _, _, err := parse_range(command); err == nil {
+			t.Errorf("parse_range(%q): no error", command)
+		}
+	}
+}
+
+func TestCommandName(t *testing.T) {
+	tests := []struct {
+		command, name, args string
+	}{
+		{"sort", "sort", ""},
+		{"sort! n", "sort!", "n"},
+		{"sort in", "sort", "in"},
+		{"t.", "t", "."},
+		{"m-2", "m", "-2"},
+		{"j!", "j!", ""},
+		{"set ts=4", "set", "ts=4"},
+	}
+	for _, test := range tests {
+		if name, args := command_name(test.command); name != test.name || args != test.args {
+			t.Errorf("command_name(%q) = %q, %q, want %q, %q", test.command, name, args, test.name, test.args)
+		}
+	}
+}
+
+func TestRunCommandLineNumber(t *testing.T) {
+	set_buffer("1", "2", "3", "4", "5", "6")
+	tests := []struct {
+		from    int
+		command string
+		want    int
+	}{
+		{0, "4", 3},
+		{1, "+3", 4},
+		{4, "-3", 1},
+		{2, "$", 5},
+		{0, "2,3", 2},
+	}
+	for _, test := range tests {
+		currentRow = test.from
+		if err := run_command(test.command); err != nil {
+			t.Errorf(":%s: %v", test.command, err)
+		} else if currentRow != test.want {
+			t.Errorf(":%s from row %d went to row %d, want %d", test.command, test.from, currentRow, test.want)
+		}
+	}
+}
+
+func TestLineCommands(t *testing.T) {
+	tests := []struct {
+		from    int
+		command string
+		want    []string
+	}{
+		{0, "m$", []string{"2", "3", "4", "1"}},
+		{3, "m0", []string{"4", "1", "2", "3"}},
+		{0, "1,2m3", []string{"3", "1", "2", "4"}},
+		{0, "m+1", []string{"2", "1", "3", "4"}},
+		{0, "t.", []string{"1", "1", "2", "3", "4"}},
+		{1, "%t$", []string{"1", "2", "3", "4", "1", "2", "3", "4"}},
+		{0, "j", []string{"1 2", "3", "4"}},
+		{0, "%j", []string{"1 2 3 4"}},
+		{0, "2,3j!", []string{"1", "23", "4"}},
+		{0, "sort!", []string{"4", "3", "2", "1"}},
+		{0, ".,+1sort!", []string{"2", "1", "3", "4"}},
+	}
+	for _, test := range tests {
+		set_buffer("1", "2", "3", "4")
+		currentRow = test.from
+		if err := run_command(test.command); err != nil {
+			t.Errorf(":%s: %v", test.command, err)
+		} else if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf(":%s from row %d = %q, want %q", test.command, test.from, got, test.want)
+		}
+	}
+	for _, command := range []string{"2,3m2", "m9", "t", "1,9j", "2w"} {
+		set_buffer("1", "2", "3", "4")
+		if err := run_command(command); err == nil {
+			t.Errorf(":%s: no error", command)
+		}
+	}
+}
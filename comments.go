@@ -0,0 +1,90 @@
+package main
+
+import "strings"
+
+// comment_markers returns what comments out a line in the current
+// language: a line comment prefix, or else the start and end of a block
+// comment wrapped around the line. ok is false for languages without
+// comments.
+func comment_markers() (open, close string, ok bool) {
+	lang := current_language()
+	if lang.lineComment != "" {
+		return lang.lineComment, "", true
+	}
+	if lang.blockComment[0] != "" {
+		return lang.blockComment[0], lang.blockComment[1], true
+	}
+	return "", "", false
+}
+
+// is_commented reports whether line, after its indentation, is commented
+// out with open and close.
+func is_commented(line []rune, open, close string) bool {
+	content := strings.TrimSpace(string(line))
+	return strings.HasPrefix(content, open) && strings.HasSuffix(content, close) &&
+		len(content) >= len(open)+len(close)
+}
+
+// operator_comment implements gc: it comments out the rows touched by r,
+// or uncomments them when every non-blank one is already commented. The
+// comment markers go after the shallowest indentation of the rows, so
+// they line up and the indentation is kept.
+func operator_comment(r text_range) {
+	open, close, ok := comment_markers()
+	if !ok {
+		statusMessage = "No comment syntax for this file type"
+		return
+	}
+	commented := true
+	indent := -1
+	for row := r.start.row; row <= r.end.row; row++ {
+		if is_blank_line(row) {
+			continue
+		}
+		commented = commented && is_commented(text_buffer[row], open, close)
+		if col := first_non_blank(row); indent < 0 || col < indent {
+			indent = col
+		}
+	}
+	if indent < 0 {
+		return
+	}
+
+	push_buffer()
+	for row := r.start.row; row <= r.end.row; row++ {
+		if is_blank_line(row) {
+			continue
+		}
+		line := text_buffer[row]
+		if commented {
+			text_buffer[row] = uncomment_line(line, open, close)
+			continue
+		}
+		commentedLine := append([]rune{}, line[:indent]...)
+		commentedLine = append(commentedLine, []rune(open+" ")...)
+		commentedLine = append(commentedLine, line[indent:]...)
+		if close != "" {
+			commentedLine = append(commentedLine, []rune(" "+close)...)
+		}
+		text_buffer[row] = commentedLine
+	}
+	currentRow, currentCol = r.start.row, first_non_blank(r.start.row)
+	modified = 0
+}
+
+// uncomment_line takes the comment markers off line, along with the space
+// next to each of them. Other blanks are kept, so that commenting a line out
+// and back in gives back the line as it was.
+func uncomment_line(line []rune, open, close string) []rune {
+	indent := leading_blanks(line)
+	content := strings.TrimPrefix(string(line[len(indent):]), open)
+	content = strings.TrimPrefix(content, " ")
+	if close != "" {
+		content = strings.TrimSuffix(strings.TrimRight(content, " \t"), close)
+		content = strings.TrimSuffix(content, " ")
+	}
+	if content == "" {
+		return []rune{}
+	}
+	return append(indent, []rune(content)...)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommentOperator(t *testing.T) {
+	saved := file_extension
+	defer func() { file_extension = saved }()
+	tests := []struct {
+		extension string
+		lines     []string
+		keys      string
+		want      []string
+	}{
+		{"go", []string{"a", "b"}, "gcc", []string{"// a", "b"}},
+		{"go", []string{"  a", "    b", "", "  c"}, "gcG", []string{"  // a", "  //   b", "", "  // c"}},
+		{"go", []string{"// a", "b"}, "gcj", []string{"// // a", "// b"}},
+		{"go", []string{"// a", "  //b"}, "gcj", []string{"a", "  b"}},
+		{"py", []string{"x = 1"}, "gcc", []string{"# x = 1"}},
+		{"css", []string{"a {}"}, "gcc", []string{"/* a {} */"}},
+		{"html", []string{"<!-- <p> -->"}, "gcc", []string{"<p>"}},
+		{"go", []string{"a", "b", "c"}, "Vjgc", []string{"// a", "// b", "c"}},
+		{"go", []string{"a", "b", "c"}, "gccjj.", []string{"// a", "b", "// c"}},
+		{"go", []string{"a", "b"}, "gccu", []string{"a", "b"}},
+	}
+	for _, test := range tests {
+		file_extension = test.extension
+		set_buffer(test.lines...)
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q on %q in .%s = %q, want %q", test.keys, test.lines, test.extension, got, test.want)
+		}
+	}
+}
+
+func TestCommentRoundTrip(t *testing.T) {
+	saved := file_extension
+	defer func() { file_extension = saved }()
+	lines := []string{"\tif x {", "\t\ty := 1  ", "", "\t  }", "\t"}
+	for _, extension := range []string{"go", "css", "lua"} {
+		file_extension = extension
+		set_buffer(lines...)
+		run_keys(t, "gcG")
+		run_keys(t, "gcG")
+		if got := buffer_lines(); !reflect.DeepEqual(got, lines) {
+			t.Errorf("gcG twice in .%s = %q, want %q", extension, got, lines)
+		}
+	}
+}
+
+func TestNoCommentSyntax(t *testing.T) {
+	saved := file_extension
+	defer func() { file_extension = saved }()
+	file_extension = "txt"
+	set_buffer("a")
+	run_keys(t, "gcc")
+	if got := string(text_buffer[0]); got != "a" || statusMessage != "No comment syntax for this file type" {
+		t.Errorf("gcc in .txt = %q, status %q", got, statusMessage)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type Options struct {
+	tabWidth     int
+	shiftWidth   int
+	expandTab    bool
+	softTabStop  int
+	wrap         bool
+	lineBreak    bool
+	breakIndent  bool
+	showBreak    string
+	mouse        bool
+	wordChars    string
+	clipboard    string
+	autoIndent   bool
+	smartIndent  bool
+	autoPairs    bool
+	autoPairsOff string
+}
+
+var options = Options{
+	tabWidth:    4,
+	expandTab:   true,
+	softTabStop: -1,
+	showBreak:   "↪ ",
+	mouse:       true,
+	wordChars:   "_",
+	clipboard:   "auto",
+	autoIndent:  true,
+	smartIndent: true,
+	autoPairs:   true,
+}
+
+// optionTable maps the names accepted by :set (and the config file) to the
+// field they control. Exactly one of the value pointers is set per entry.
+var optionTable = []struct {
+	name, short string
+	boolValue   *bool
+	intValue    *int
+	stringValue *string
+}{
+	{name: "tabwidth", short: "ts", intValue: &options.tabWidth},
+	{name: "shiftwidth", short: "sw", intValue: &options.shiftWidth},
+	{name: "expandtab", short: "et", boolValue: &options.expandTab},
+	{name: "softtabstop", short: "sts", intValue: &options.softTabStop},
+	{name: "wrap", boolValue: &options.wrap},
+	{name: "linebreak", short: "lbr", boolValue: &options.lineBreak},
+	{name: "breakindent", short: "bri", boolValue: &options.breakIndent},
+	{name: "showbreak", short: "sbr", stringValue: &options.showBreak},
+	{name: "mouse", boolValue: &options.mouse},
+	{name: "wordchars", short: "wc", stringValue: &options.wordChars},
+	{name: "clipboard", short: "cb", stringValue: &options.clipboard},
+	{name: "autoindent", short: "ai", boolValue: &options.autoIndent},
+	{name: "smartindent", short: "si", boolValue: &options.smartIndent},
+	{name: "autopairs", short: "ap", boolValue: &options.autoPairs},
+	{name: "autopairsoff", short: "apo", stringValue: &options.autoPairsOff},
+}
+
+func config_path() string {
+	dirname, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dirname, ".onyxrc")
+}
+
+// load_config runs every line of ~/.onyxrc as if it had been typed after ':'.
+// Blank lines and lines starting with '#' or '"' are ignored.
+func load_config() {
+	path := config_path()
+	if path == "" {
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "\"") {
+			continue
+		}
+		if err := run_command(strings.TrimPrefix(line, ":")); err != nil {
+			statusMessage = fmt.Sprintf(".onyxrc line %d: %v", lineNumber, err)
+		}
+	}
+}
+
+// set_option applies a single :set argument such as "expandtab",
+// "noexpandtab", "ts=8" or "tabwidth?".
+func set_option(arg string) error {
+	name, value, hasValue := strings.Cut(arg, "=")
+	query := strings.HasSuffix(name, "?")
+	name = strings.TrimSuffix(name, "?")
+
+	negate := false
+	if strings.HasPrefix(name, "no") && find_option(name) < 0 {
+		negate = true
+		name = strings.TrimPrefix(name, "no")
+	}
+
+	index := find_option(name)
+	if index < 0 {
+		return fmt.Errorf("unknown option: %s", name)
+	}
+	option := optionTable[index]
+
+	switch {
+	case query:
+		if option.boolValue != nil {
+			if *option.boolValue {
+				statusMessage = option.name
+			} else {
+				statusMessage = "no" + option.name
+			}
+		} else if option.stringValue != nil {
+			statusMessage = option.name + "=" + *option.stringValue
+		} else {
+			statusMessage = option.name + "=" + strconv.Itoa(*option.intValue)
+		}
+	case option.boolValue != nil:
+		if hasValue {
+			return fmt.Errorf("invalid argument: %s", arg)
+		}
+		*option.boolValue = !negate
+	case option.stringValue != nil:
+		if negate || !hasValue {
+			return fmt.Errorf("invalid argument: %s", arg)
+		}
+		if option.stringValue == &options.clipboard && value != "auto" && find_clipboard_provider(value) == nil {
+			return fmt.Errorf("invalid argument: %s", arg)
+		}
+		*option.stringValue = value
+	default:
+		if negate || !hasValue {
+			return fmt.Errorf("invalid argument: %s", arg)
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("number required after =: %s", arg)
+		}
+		if option.intValue == &options.tabWidth && number < 1 {
+			return fmt.Errorf("argument must be positive: %s", arg)
+		}
+		if option.intValue == &options.shiftWidth && number < 0 {
+			return fmt.Errorf("argument must be positive or zero: %s", arg)
+		}
+		*option.intValue = number
+	}
+	return nil
+}
+
+func find_option(name string) int {
+	for i, option := range optionTable {
+		if option.name == name || option.short == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// soft_tab_stop returns the effective softtabstop, where a negative value
+// follows tabwidth and zero turns the feature off.
+func soft_tab_stop() int {
+	if options.softTabStop < 0 {
+		return options.tabWidth
+	}
+	return options.softTabStop
+}
@@ -0,0 +1,71 @@
+package main
+
+import "unicode"
+
+const zeroWidthJoiner = '\u200d'
+
+// is_grapheme_extend reports whether r attaches to the rune before it
+// instead of starting a new user-perceived character.
+func is_grapheme_extend(r rune) bool {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc):
+		return true
+	case r == zeroWidthJoiner:
+		return true
+	case r >= 0xfe00 && r <= 0xfe0f: // variation selectors
+		return true
+	case r >= 0x1f3fb && r <= 0x1f3ff: // emoji skin tone modifiers
+		return true
+	case r >= 0xe0020 && r <= 0xe007f: // emoji tag sequences
+		return true
+	case r >= 0xe0100 && r <= 0xe01ef: // variation selectors supplement
+		return true
+	}
+	return false
+}
+
+func is_regional_indicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// grapheme_end returns the index just past the grapheme cluster that starts
+// at col: a base rune plus any combining marks, variation selectors and
+// zero-width-joined runes, or a pair of regional indicators (a flag).
+func grapheme_end(line []rune, col int) int {
+	if col >= len(line) {
+		return len(line)
+	}
+	end := col + 1
+	if is_regional_indicator(line[col]) && end < len(line) && is_regional_indicator(line[end]) {
+		return end + 1
+	}
+	for end < len(line) {
+		if is_grapheme_extend(line[end]) || line[end-1] == zeroWidthJoiner {
+			end++
+			continue
+		}
+		break
+	}
+	return end
+}
+
+// grapheme_start returns the start of the grapheme cluster containing col.
+func grapheme_start(line []rune, col int) int {
+	start := 0
+	for start < len(line) {
+		end := grapheme_end(line, start)
+		if end > col {
+			return start
+		}
+		start = end
+	}
+	return len(line)
+}
+
+// prev_grapheme returns the start of the grapheme cluster before col.
+func prev_grapheme(line []rune, col int) int {
+	if col <= 0 {
+		return 0
+	}
+	return grapheme_start(line, col-1)
+}
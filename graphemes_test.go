@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+func TestGraphemeEnd(t *testing.T) {
+	tests := []struct {
+		line string
+		col  int
+		want int
+	}{
+		{"abc", 0, 1},
+		{"abc", 2, 3},
+		{"abc", 3, 3},
+		{"e\u0301x", 0, 2},
+		{"a\u0301\u0302b", 0, 3},
+		{"\u2764\ufe0fx", 0, 2},
+		{"\U0001f469\u200d\U0001f4bbx", 0, 3},
+		{"\U0001f1eb\U0001f1f7x", 0, 2},
+		{"\U0001f1eb\U0001f1f7\U0001f1e9\U0001f1ea", 2, 4},
+		{"\U0001f1ebx", 0, 1},
+		{"日本", 0, 1},
+	}
+	for _, test := range tests {
+		if got := grapheme_end([]rune(test.line), test.col); got != test.want {
+			t.Errorf("grapheme_end(%q, %d) = %d, want %d", test.line, test.col, got, test.want)
+		}
+	}
+}
+
+func TestGraphemeStart(t *testing.T) {
+	tests := []struct {
+		line string
+		col  int
+		want int
+	}{
+		{"abc", 1, 1},
+		{"e\u0301x", 1, 0},
+		{"e\u0301x", 2, 2},
+		{"\U0001f469\u200d\U0001f4bb", 2, 0},
+		{"\U0001f1eb\U0001f1f7\U0001f1e9\U0001f1ea", 3, 2},
+	}
+	for _, test := range tests {
+		if got := grapheme_start([]rune(test.line), test.col); got != test.want {
+			t.Errorf("grapheme_start(%q, %d) = %d, want %d", test.line, test.col, got, test.want)
+		}
+	}
+}
+
+func TestGraphemeColumns(t *testing.T) {
+	keep_options(t)
+	options.tabWidth = 4
+	tests := []struct {
+		line string
+		col  int
+		want int
+	}{
+		{"日本x", 1, 2},
+		{"日本x", 2, 4},
+		{"éx", 2, 1},
+		{"\x01x", 1, 2},
+		{"\U0001f1eb\U0001f1f7x", 2, 2},
+		{"日\tx", 2, 4},
+	}
+	for _, test := range tests {
+		if got := visual_col([]rune(test.line), test.col); got != test.want {
+			t.Errorf("visual_col(%q, %d) = %d, want %d", test.line, test.col, got, test.want)
+		}
+	}
+	if got := col_from_visual([]rune("日本x"), 3); got != 1 {
+		t.Errorf("col_from_visual on the right half of a wide character = %d, want 1", got)
+	}
+	if got := cursor_width([]rune("日本"), 0); got != 2 {
+		t.Errorf("cursor_width on a wide character = %d, want 2", got)
+	}
+}
+
+func TestBackspaceGrapheme(t *testing.T) {
+	keep_options(t)
+	options.softTabStop = 0
+	set_buffer("aé\U0001f1eb\U0001f1f7")
+	currentCol = len(text_buffer[0])
+	delete_rune()
+	if got := string(text_buffer[0]); got != "aé" {
+		t.Errorf("Backspace after a flag left %q", got)
+	}
+	delete_rune()
+	if got := string(text_buffer[0]); got != "a" {
+		t.Errorf("Backspace after a combining mark left %q", got)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// editor_info is what ~/.onyxinfo keeps between sessions.
+type editor_info struct {
+	Registers   map[string]saved_register            `json:"registers"`
+	Marks       map[string]map[string]saved_position `json:"marks,omitempty"`
+	GlobalMarks map[string]saved_mark                `json:"globalMarks,omitempty"`
+}
+
+type saved_register struct {
+	Text     string `json:"text"`
+	Linewise bool   `json:"linewise,omitempty"`
+}
+
+type saved_position struct {
+	Row int `json:"row"`
+	Col int `json:"col"`
+}
+
+type saved_mark struct {
+	File string `json:"file"`
+	Row  int    `json:"row"`
+	Col  int    `json:"col"`
+}
+
+func info_path() string {
+	dirname, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dirname, ".onyxinfo")
+}
+
+// read_info reads ~/.onyxinfo, returning an empty editor_info if there is
+// none yet.
+func read_info() editor_info {
+	info := editor_info{Registers: map[string]saved_register{}}
+	data, err := os.ReadFile(info_path())
+	if err != nil {
+		return info
+	}
+	json.Unmarshal(data, &info)
+	return info
+}
+
+// load_info restores the named registers, and with them any recorded
+// macros, and the marks from ~/.onyxinfo.
+func load_info() {
+	info := read_info()
+	for name, value := range info.Registers {
+		runes := []rune(name)
+		if len(runes) == 1 && runes[0] >= 'a' && runes[0] <= 'z' {
+			registers[runes[0]] = register{[]rune(value.Text), value.Linewise}
+		}
+	}
+	for name, mark := range info.GlobalMarks {
+		runes := []rune(name)
+		if len(runes) == 1 && runes[0] >= 'A' && runes[0] <= 'Z' {
+			globalMarks[runes[0]] = file_mark{mark.File, position{mark.Row, mark.Col}}
+		}
+	}
+	load_file_marks(info)
+}
+
+// load_file_marks restores the a-z marks of the open file.
+func load_file_marks(info editor_info) {
+	for name, p := range info.Marks[current_file_path()] {
+		runes := []rune(name)
+		if len(runes) == 1 && runes[0] >= 'a' && runes[0] <= 'z' {
+			marks[runes[0]] = position{p.Row, p.Col}
+		}
+	}
+}
+
+// save_info writes the named registers and the marks to ~/.onyxinfo, keeping
+// the marks saved for other files.
+func save_info() error {
+	path := info_path()
+	if path == "" {
+		return nil
+	}
+	info := read_info()
+	info.Registers = map[string]saved_register{}
+	for name := 'a'; name <= 'z'; name++ {
+		if value := registers[name]; len(value.text) > 0 {
+			info.Registers[string(name)] = saved_register{string(value.text), value.linewise}
+		}
+	}
+	if info.Marks == nil {
+		info.Marks = map[string]map[string]saved_position{}
+	}
+	fileMarks := map[string]saved_position{}
+	for name, p := range marks {
+		fileMarks[string(name)] = saved_position{p.row, p.col}
+	}
+	info.Marks[current_file_path()] = fileMarks
+	if len(fileMarks) == 0 {
+		delete(info.Marks, current_file_path())
+	}
+	info.GlobalMarks = map[string]saved_mark{}
+	for name, mark := range globalMarks {
+		info.GlobalMarks[string(name)] = saved_mark{mark.file, mark.row, mark.col}
+	}
+	// Keep macros readable when editing the file, without "<" as \u003c
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(info); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data.Bytes(), 0o600)
+}
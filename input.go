@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// keyPaste is the key of an input_event holding a bracketed paste. termbox
+// leaves this key unused.
+const keyPaste termbox.Key = 0xFF00
+
+// input_event is an event read from the terminal or replayed from . or a
+// macro. A bracketed paste is a single keyPaste event carrying the pasted
+// text, so replaying it inserts the same text again.
+type input_event struct {
+	termbox.Event
+	paste []rune
+}
+
+// paste_event returns a keyPaste event carrying text.
+func paste_event(text []rune) input_event {
+	return input_event{termbox.Event{Type: termbox.EventKey, Key: keyPaste}, text}
+}
+
+// insert_paste inserts the text of a bracketed paste at the cursor as it
+// is, in one change that a single undo takes back.
+func insert_paste(event input_event) {
+	if len(event.paste) == 0 {
+		return
+	}
+	push_buffer()
+	end := insert_text(cursor(), event.paste)
+	currentRow, currentCol = end.row, end.col
+	modified = 0
+}
+
+// pasted_line is the first line of a bracketed paste, for pasting into the
+// command line and search prompts.
+func pasted_line(event input_event) string {
+	text, _, _ := strings.Cut(string(event.paste), "\n")
+	return text
+}
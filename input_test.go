@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// run_paste handles keys, then a bracketed paste of text, then after.
+func run_paste(t *testing.T, keys, text, after string) {
+	t.Helper()
+	pendingInput = append(key_events(keys), paste_event([]rune(text)))
+	pendingInput = append(pendingInput, key_events(after)...)
+	run_keys(t, "")
+}
+
+func TestBracketedPaste(t *testing.T) {
+	keep_options(t)
+	options.tabWidth, options.expandTab = 4, true
+	tests := []struct {
+		lines []string
+		keys  string
+		text  string
+		after string
+		want  []string
+	}{
+		{[]string{"ab"}, "l", "x\n\ty", "", []string{"ax", "\tyb"}},
+		{[]string{"ab"}, "li", "(\n", "\x1b", []string{"a(", "b"}},
+		{[]string{"ab"}, "li", "one two", "\x1b", []string{"aone twob"}},
+		{[]string{"ab"}, "l", "x\ny", "u", []string{"ab"}},
+		{[]string{"ab"}, "li", "xy", "\x1bu", []string{"ab"}},
+		{[]string{"ab"}, "vl", "x", "", []string{"axb"}},
+		{[]string{"a", "b"}, "i", "<x>", "\x1bj0.", []string{"<x>a", "<x>b"}},
+		{[]string{"a", "b"}, "i", "1\n2", "\x1bj0.", []string{"1", "2a", "1", "2b"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		run_paste(t, test.keys, test.text, test.after)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q, paste %q, %q on %q = %q, want %q", test.keys, test.text, test.after, test.lines, got, test.want)
+		}
+		mode = 0
+	}
+}
+
+func TestPasteInMacro(t *testing.T) {
+	set_buffer("a", "b")
+	registers = map[rune]register{'a': {text: []rune("0i<PasteStart><lt>\n<PasteEnd><Esc>j")}}
+	run_keys(t, "2@a")
+	if got := buffer_lines(); !reflect.DeepEqual(got, []string{"<", "a", "<", "b"}) {
+		t.Errorf("macro with a paste = %q", got)
+	}
+}
+
+func TestPastedLine(t *testing.T) {
+	if got := pasted_line(paste_event([]rune("first\nsecond"))); got != "first" {
+		t.Errorf("pasted_line = %q", got)
+	}
+	if got := pasted_line(key_events("x")[0]); got != "" {
+		t.Errorf("pasted_line of a key = %q", got)
+	}
+}
@@ -0,0 +1,158 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// escapeTimeout is how long to wait for the rest of an escape sequence
+// before taking a lone ESC as the Esc key.
+const escapeTimeout = 25 * time.Millisecond
+
+// raw_read is one read from the terminal by read_terminal.
+type raw_read struct {
+	event termbox.Event
+	data  []byte
+}
+
+var (
+	pasteStart = []byte("\x1b[200~")
+	pasteEnd   = []byte("\x1b[201~")
+	// rawInput holds bytes read from the terminal that are not yet events,
+	// of which the first pasteScanned have been searched for pasteEnd
+	rawInput     []byte
+	pasteScanned int
+	rawReads     chan raw_read
+	escapeTimer  *time.Timer
+)
+
+// enable_bracketed_paste asks the terminal to mark pasted text with
+// pasteStart and pasteEnd, and disable_bracketed_paste undoes that.
+func enable_bracketed_paste() {
+	fmt.Print("\x1b[?2004h")
+}
+
+func disable_bracketed_paste() {
+	fmt.Print("\x1b[?2004l")
+}
+
+// read_terminal passes every read from the terminal to poll_event, which
+// can then give up waiting for the rest of an escape sequence.
+func read_terminal() {
+	for {
+		data := make([]byte, 4096)
+		event := termbox.PollRawEvent(data)
+		if event.Type == termbox.EventRaw {
+			data = data[:event.N]
+		}
+		rawReads <- raw_read{event, data}
+	}
+}
+
+// poll_event waits for the next event like termbox.PollEvent, but reads
+// the raw input itself so a bracketed paste arrives as a single keyPaste
+// event instead of a key press per character. An ESC followed within
+// escapeTimeout by a key is taken as Alt and the key, as terminals send it.
+func poll_event() input_event {
+	if rawReads == nil {
+		rawReads = make(chan raw_read)
+		go read_terminal()
+	}
+	timedOut := false
+	for {
+		if bytes.HasPrefix(rawInput, pasteStart) {
+			// Only the bytes read since the last look can complete pasteEnd
+			from := max(pasteScanned-len(pasteEnd)+1, len(pasteStart))
+			if end := bytes.Index(rawInput[from:], pasteEnd); end >= 0 {
+				end += from
+				text := string(rawInput[len(pasteStart):end])
+				rawInput = rawInput[end+len(pasteEnd):]
+				pasteScanned = 0
+				text = strings.ReplaceAll(text, "\r\n", "\n")
+				return paste_event([]rune(strings.ReplaceAll(text, "\r", "\n")))
+			}
+			pasteScanned = len(rawInput)
+		} else if event, n := alt_event(rawInput); n > 0 {
+			rawInput = rawInput[n:]
+			return input_event{Event: event}
+		} else if len(rawInput) > 0 && (timedOut || !incomplete_escape(rawInput)) {
+			event := termbox.ParseEvent(rawInput)
+			if event.N > 0 {
+				rawInput = rawInput[event.N:]
+				if event.Type != termbox.EventNone {
+					return input_event{Event: event}
+				}
+				continue
+			}
+		}
+
+		var timeout <-chan time.Time
+		if incomplete_escape(rawInput) && !timedOut {
+			if escapeTimer == nil {
+				escapeTimer = time.NewTimer(escapeTimeout)
+			} else {
+				escapeTimer.Reset(escapeTimeout)
+			}
+			timeout = escapeTimer.C
+		}
+		timedOut = false
+		select {
+		case read := <-rawReads:
+			// Stop the timer, emptying it if it fired meanwhile, so a stale
+			// tick can't cut the next wait short
+			if timeout != nil && !escapeTimer.Stop() {
+				<-escapeTimer.C
+			}
+			switch read.event.Type {
+			case termbox.EventRaw:
+				rawInput = append(rawInput, read.data...)
+			case termbox.EventResize, termbox.EventError:
+				return input_event{Event: read.event}
+			}
+		case <-timeout:
+			timedOut = true
+		}
+	}
+}
+
+// alt_event reads a key pressed with Alt, which terminals send as ESC
+// followed by the key, from the start of data. It returns the event and the
+// number of bytes it took, or 0 when data doesn't start with one.
+func alt_event(data []byte) (termbox.Event, int) {
+	if len(data) < 2 || data[0] != 0x1b || data[1] == '[' || data[1] == 'O' || data[1] == 0x1b {
+		return termbox.Event{}, 0
+	}
+	event := termbox.ParseEvent(data[1:])
+	if event.Type != termbox.EventKey || event.N == 0 {
+		return termbox.Event{}, 0
+	}
+	event.Mod |= termbox.ModAlt
+	return event, event.N + 1
+}
+
+// incomplete_escape reports whether data starts with an escape sequence
+// that may still be arriving: a lone ESC, or ESC [ or ESC O without the
+// byte that ends the sequence.
+func incomplete_escape(data []byte) bool {
+	if len(data) == 0 || data[0] != 0x1b {
+		return false
+	}
+	if len(data) == 1 {
+		return true
+	}
+	if data[1] != '[' && data[1] != 'O' {
+		return false
+	}
+	for _, b := range data[2:] {
+		if b >= 0x40 && b <= 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+//go:build !windows
+
+package main
+
+import "testing"
+
+func TestIncompleteEscape(t *testing.T) {
+	tests := []struct {
+		data string
+		want bool
+	}{
+		{"", false},
+		{"a", false},
+		{"\x1b", true},
+		{"\x1b[", true},
+		{"\x1b[1;5", true},
+		{"\x1b[A", false},
+		{"\x1bOA", false},
+		{"\x1bO", true},
+		{"\x1bj", false},
+		{"\x1b[200~", false},
+	}
+	for _, test := range tests {
+		if got := incomplete_escape([]byte(test.data)); got != test.want {
+			t.Errorf("incomplete_escape(%q) = %v, want %v", test.data, got, test.want)
+		}
+	}
+}
+
+func TestAltEvent(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+		n    int
+	}{
+		{"\x1bj", "<M-j>", 2},
+		{"\x1bJx", "<M-J>", 2},
+		{"\x1b\r", "<M-CR>", 2},
+		{"\x1b", "", 0},
+		{"\x1b\x1b", "", 0},
+		{"\x1b[A", "", 0},
+		{"\x1bOA", "", 0},
+		{"j", "", 0},
+	}
+	for _, test := range tests {
+		event, n := alt_event([]byte(test.data))
+		if got := key_name(input_event{Event: event}); n != test.n || n > 0 && got != test.want {
+			t.Errorf("alt_event(%q) = %q, %d, want %q, %d", test.data, got, n, test.want, test.n)
+		}
+	}
+}
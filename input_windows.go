@@ -0,0 +1,17 @@
+//go:build windows
+
+package main
+
+import "github.com/nsf/termbox-go"
+
+// The Windows console has no bracketed paste, so there is nothing to turn
+// on or off.
+func enable_bracketed_paste() {}
+
+func disable_bracketed_paste() {}
+
+// poll_event waits for the next event. termbox reads the Windows console as
+// events rather than raw bytes, so a paste arrives as typed keys.
+func poll_event() input_event {
+	return input_event{Event: termbox.PollEvent()}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+var specialKeyNames = map[termbox.Key]string{
+	termbox.KeyEnter:      "<CR>",
+	termbox.KeyEsc:        "<Esc>",
+	termbox.KeyTab:        "<Tab>",
+	termbox.KeySpace:      " ",
+	termbox.KeyBackspace:  "<BS>",
+	termbox.KeyBackspace2: "<BS>",
+	termbox.KeyDelete:     "<Del>",
+	termbox.KeyInsert:     "<Insert>",
+	termbox.KeyArrowUp:    "<Up>",
+	termbox.KeyArrowDown:  "<Down>",
+	termbox.KeyArrowLeft:  "<Left>",
+	termbox.KeyArrowRight: "<Right>",
+	termbox.KeyHome:       "<Home>",
+	termbox.KeyEnd:        "<End>",
+	termbox.KeyPgup:       "<PageUp>",
+	termbox.KeyPgdn:       "<PageDown>",
+}
+
+// key_name returns a vim-style name for a key event: the character itself
+// for printable keys, "<CR>", "<Up>" and so on for special keys, "<C-x>"
+// for control keys and "<M-x>" for keys pressed with Alt. Mouse and resize
+// events have no name.
+func key_name(event input_event) string {
+	if event.Type != termbox.EventKey {
+		return ""
+	}
+	if event.Mod&termbox.ModAlt != 0 {
+		event.Mod &^= termbox.ModAlt
+		if name := strings.Trim(key_name(event), "<>"); name != "" {
+			return "<M-" + name + ">"
+		}
+		return ""
+	}
+	if event.Ch != 0 {
+		return string(event.Ch)
+	}
+	if name, found := specialKeyNames[event.Key]; found {
+		return name
+	}
+	if event.Key >= termbox.KeyCtrlA && event.Key <= termbox.KeyCtrlZ {
+		return "<C-" + string(rune('a'+event.Key-termbox.KeyCtrlA)) + ">"
+	}
+	return ""
+}
+
+// key_char returns the character a key types, treating Space and Tab as
+// characters, or 0 for keys that don't type one.
+func key_char(event input_event) rune {
+	switch {
+	case event.Ch != 0:
+		return event.Ch
+	case event.Key == termbox.KeySpace:
+		return ' '
+	case event.Key == termbox.KeyTab:
+		return '\t'
+	}
+	return 0
+}
+
+// key_notation writes events the way they are written in a macro register:
+// characters as themselves, '<' as "<lt>", other keys by key_name and a
+// paste as its text between "<PasteStart>" and "<PasteEnd>".
+func key_notation(events []input_event) string {
+	var text strings.Builder
+	for _, event := range events {
+		if event.Key == keyPaste {
+			pasted := strings.ReplaceAll(string(event.paste), "<", "<lt>")
+			text.WriteString("<PasteStart>" + pasted + "<PasteEnd>")
+			continue
+		}
+		name := key_name(event)
+		if name == "<" {
+			name = "<lt>"
+		}
+		text.WriteString(name)
+	}
+	return text.String()
+}
+
+// parse_keys reads text written in key notation back into key events. A
+// '<' that doesn't start a known key name is taken literally, as is a line
+// break, which is Enter. The text after "<PasteStart>" up to "<PasteEnd>"
+// is a paste.
+func parse_keys(text string) []input_event {
+	events := []input_event{}
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] == '<' {
+			if string(runes[i:min(i+len("<PasteStart>"), len(runes))]) == "<PasteStart>" {
+				pasted, _, _ := strings.Cut(string(runes[i+len("<PasteStart>"):]), "<PasteEnd>")
+				events = append(events, paste_event([]rune(strings.ReplaceAll(pasted, "<lt>", "<"))))
+				i += len([]rune("<PasteStart>"+pasted+"<PasteEnd>")) - 1
+				continue
+			}
+			end := i + 1
+			for end < len(runes) && runes[end] != '>' && runes[end] != '<' {
+				end++
+			}
+			if end < len(runes) && runes[end] == '>' {
+				if event, found := key_from_name(string(runes[i : end+1])); found {
+					events = append(events, event)
+					i = end
+					continue
+				}
+			}
+		}
+		event := termbox.Event{Type: termbox.EventKey}
+		switch runes[i] {
+		case '\n':
+			event.Key = termbox.KeyEnter
+		case ' ':
+			event.Key = termbox.KeySpace
+		default:
+			event.Ch = runes[i]
+		}
+		events = append(events, input_event{Event: event})
+	}
+	return events
+}
+
+// key_from_name is the reverse of key_name for names in angle brackets.
+func key_from_name(name string) (input_event, bool) {
+	event := input_event{Event: termbox.Event{Type: termbox.EventKey}}
+	if name == "<lt>" {
+		event.Ch = '<'
+		return event, true
+	}
+	if strings.HasPrefix(name, "<M-") && len(name) > 4 {
+		inner := []rune(name[3 : len(name)-1])
+		found := len(inner) == 1
+		if found {
+			event.Ch = inner[0]
+		} else {
+			event, found = key_from_name("<" + string(inner) + ">")
+		}
+		event.Mod = termbox.ModAlt
+		return event, found
+	}
+	if len(name) == 5 && strings.HasPrefix(name, "<C-") && name[3] >= 'a' && name[3] <= 'z' {
+		event.Key = termbox.KeyCtrlA + termbox.Key(name[3]-'a')
+		return event, true
+	}
+	for key, keyName := range specialKeyNames {
+		// KeyBackspace2 is what terminals send for the Backspace key
+		if keyName == name && key != termbox.KeyBackspace {
+			event.Key = key
+			return event, true
+		}
+	}
+	return event, false
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestKeyNotationRoundTrip(t *testing.T) {
+	tests := []struct {
+		events []input_event
+		want   string
+	}{
+		{parse_keys("dw"), "dw"},
+		{parse_keys("i<lt>a><Esc>"), "i<lt>a><Esc>"},
+		{parse_keys("<C-a><M-j><CR>"), "<C-a><M-j><CR>"},
+		{[]input_event{paste_event([]rune("\n\tx("))}, "<PasteStart>\n\tx(<PasteEnd>"},
+		{[]input_event{paste_event([]rune("<lt> <a>"))}, "<PasteStart><lt>lt> <lt>a><PasteEnd>"},
+		{append(parse_keys("i"), paste_event([]rune("<PasteEnd>")), input_event{Event: termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEsc}}),
+			"i<PasteStart><lt>PasteEnd><PasteEnd><Esc>"},
+	}
+	for _, test := range tests {
+		notation := key_notation(test.events)
+		if notation != test.want {
+			t.Errorf("key_notation = %q, want %q", notation, test.want)
+		}
+		parsed := parse_keys(notation)
+		if len(parsed) != len(test.events) {
+			t.Errorf("parse_keys(%q) gave %d keys, want %d", notation, len(parsed), len(test.events))
+			continue
+		}
+		for i, event := range parsed {
+			if event.Key != test.events[i].Key || event.Ch != test.events[i].Ch || event.Mod != test.events[i].Mod ||
+				string(event.paste) != string(test.events[i].paste) {
+				t.Errorf("parse_keys(%q)[%d] = %+v, want %+v", notation, i, event, test.events[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import "strings"
+
+// language holds the per-language rules the editor follows, picked by
+// file_extension.
+type language struct {
+	name       string
+	extensions []string
+	// indentAfter lists the characters that open a new indentation level
+	// when they end a line, and dedentOn the closing brackets that end one
+	// when they start a line.
+	indentAfter string
+	dedentOn    string
+	// pairs lists the characters typed in pairs, each opening character
+	// followed by its closing one.
+	pairs string
+	// lineComment starts a comment running to the end of the line and
+	// blockComment holds the start and end of a comment that may span
+	// lines. quotes lists the characters that delimit strings.
+	lineComment  string
+	blockComment [2]string
+	quotes       string
+}
+
+// defaultLanguage is used for files with an extension not listed in
+// languageTable.
+var defaultLanguage = language{name: "default", indentAfter: "{([", dedentOn: "})]", pairs: "()[]{}\"\"''``", quotes: "\"'"}
+
+var languageTable = []language{
+	{name: "text", extensions: []string{"txt", "md", "markdown", "rst", "csv"}, pairs: "()[]{}\"\""},
+	{name: "c", extensions: []string{"c", "h", "cpp", "cc", "hpp", "cs", "java", "kt", "swift", "dart", "scala", "zig"}, indentAfter: "{([", dedentOn: "})]", pairs: "()[]{}\"\"''", lineComment: "//", blockComment: [2]string{"/*", "*/"}, quotes: "\"'"},
+	{name: "go", extensions: []string{"go"}, indentAfter: "{([", dedentOn: "})]", pairs: "()[]{}\"\"''``", lineComment: "//", blockComment: [2]string{"/*", "*/"}, quotes: "\"'`"},
+	{name: "rust", extensions: []string{"rs"}, indentAfter: "{([", dedentOn: "})]", pairs: "()[]{}\"\"", lineComment: "//", blockComment: [2]string{"/*", "*/"}, quotes: "\""},
+	{name: "javascript", extensions: []string{"js", "jsx", "ts", "tsx", "mjs", "cjs", "json", "astro", "vue", "svelte"}, indentAfter: "{([", dedentOn: "})]", pairs: "()[]{}\"\"''``", lineComment: "//", blockComment: [2]string{"/*", "*/"}, quotes: "\"'`"},
+	{name: "css", extensions: []string{"css", "scss", "less"}, indentAfter: "{(", dedentOn: "})", pairs: "()[]{}\"\"''", blockComment: [2]string{"/*", "*/"}, quotes: "\"'"},
+	{name: "html", extensions: []string{"html", "htm", "xml", "svg"}, indentAfter: "{(", dedentOn: "})", pairs: "()[]{}\"\"''", blockComment: [2]string{"<!--", "-->"}, quotes: "\""},
+	{name: "python", extensions: []string{"py", "pyw"}, indentAfter: "{([:", dedentOn: "})]", pairs: "()[]{}\"\"''", lineComment: "#", quotes: "\"'"},
+	{name: "shell", extensions: []string{"sh", "bash", "zsh"}, indentAfter: "{(", dedentOn: "})", pairs: "()[]{}\"\"''``", lineComment: "#", quotes: "\"'"},
+	{name: "lua", extensions: []string{"lua"}, indentAfter: "{([", dedentOn: "})]", pairs: "()[]{}\"\"''", lineComment: "--", blockComment: [2]string{"--[[", "]]"}, quotes: "\"'"},
+	{name: "yaml", extensions: []string{"yml", "yaml"}, indentAfter: ":", pairs: "()[]{}\"\"''", lineComment: "#", quotes: "\"'"},
+	{name: "toml", extensions: []string{"toml", "ini", "conf"}, pairs: "()[]{}\"\"''", lineComment: "#", quotes: "\"'"},
+	{name: "sql", extensions: []string{"sql"}, indentAfter: "(", dedentOn: ")", pairs: "()\"\"''", lineComment: "--", blockComment: [2]string{"/*", "*/"}, quotes: "\"'"},
+	{name: "ruby", extensions: []string{"rb"}, indentAfter: "{([|", dedentOn: "})]", pairs: "()[]{}\"\"''", lineComment: "#", quotes: "\"'"},
+}
+
+// current_language returns the rules for the file being edited.
+func current_language() *language {
+	for i := range languageTable {
+		for _, extension := range languageTable[i].extensions {
+			if strings.EqualFold(extension, file_extension) {
+				return &languageTable[i]
+			}
+		}
+	}
+	return &defaultLanguage
+}
+
+// opening_bracket returns the bracket that close closes.
+func opening_bracket(close rune) rune {
+	switch close {
+	case ')':
+		return '('
+	case ']':
+		return '['
+	case '}':
+		return '{'
+	}
+	return 0
+}
+
+// leading_blanks returns a copy of the spaces and tabs that start line.
+func leading_blanks(line []rune) []rune {
+	col := 0
+	for col < len(line) && (line[col] == ' ' || line[col] == '\t') {
+		col++
+	}
+	return append([]rune{}, line[:col]...)
+}
+
+// opens_indent reports whether line ends, ignoring trailing blanks, with a
+// character that opens an indentation level.
+func opens_indent(line []rune) bool {
+	trimmed := strings.TrimRight(string(line), " \t")
+	if trimmed == "" || !options.smartIndent {
+		return false
+	}
+	return strings.ContainsRune(current_language().indentAfter, []rune(trimmed)[len([]rune(trimmed))-1])
+}
+
+// starts_dedent reports whether line starts, after its indentation, with a
+// bracket that closes an indentation level.
+func starts_dedent(line []rune) bool {
+	content := line[len(leading_blanks(line)):]
+	return options.smartIndent && len(content) > 0 && strings.ContainsRune(current_language().dedentOn, content[0])
+}
+
+// new_line_indent is the indentation for a line opened after line:
+// the same as line, one level more when line opens a block.
+func new_line_indent(line []rune) []rune {
+	if !options.autoIndent {
+		return []rune{}
+	}
+	if opens_indent(line) {
+		return make_indent(indent_width(line) + shift_width())
+	}
+	return leading_blanks(line)
+}
+
+// remove_indent_level takes one level of indentation off indent.
+func remove_indent_level(indent []rune) []rune {
+	return make_indent(max(indent_width(indent)-shift_width(), 0))
+}
+
+// dedent_closer re-indents the current line before close is typed as its
+// first character, lining it up with the line of the bracket it closes.
+func dedent_closer(close rune) {
+	line := text_buffer[currentRow]
+	if !options.smartIndent || !options.autoIndent || !is_indentation(line[:currentCol]) ||
+		!strings.ContainsRune(current_language().dedentOn, close) {
+		return
+	}
+	indent := remove_indent_level(leading_blanks(line))
+	if open := opening_bracket(close); open != 0 {
+		if p, ok := enclosing_bracket(open, close, 1); ok {
+			indent = leading_blanks(text_buffer[p.row])
+		}
+	}
+	blanks := len(leading_blanks(line))
+	text_buffer[currentRow] = append(indent, line[blanks:]...)
+	currentCol = len(indent)
+}
+
+// autoIndented is set while the current line holds only the indentation
+// that opening it added, which is taken away again when nothing is typed
+// on it.
+var autoIndented bool
+
+// drop_auto_indent clears the current line when it still holds nothing but
+// its automatic indentation.
+func drop_auto_indent() {
+	if autoIndented && is_indentation(text_buffer[currentRow]) {
+		text_buffer[currentRow] = []rune{}
+		currentCol = 0
+	}
+	autoIndented = false
+}
+
+// open_line_above starts a new indented line above the current one in
+// INSERT mode, as O does.
+func open_line_above() {
+	push_buffer()
+	line := text_buffer[currentRow]
+	indent := []rune{}
+	if options.autoIndent {
+		indent = leading_blanks(line)
+		if starts_dedent(line) {
+			indent = make_indent(indent_width(line) + shift_width())
+		}
+	}
+	insert_lines(currentRow, [][]rune{indent})
+	currentCol = len(indent)
+	autoIndented = len(indent) > 0
+	modified = 0
+	mode = 1
+}
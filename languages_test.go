@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAutoIndent(t *testing.T) {
+	keep_options(t)
+	saved := file_extension
+	t.Cleanup(func() { file_extension = saved })
+	file_extension = "go"
+	options.expandTab, options.tabWidth = true, 4
+	tests := []struct {
+		lines []string
+		keys  string
+		want  []string
+	}{
+		{[]string{"func f() {"}, "oreturn\x1b", []string{"func f() {", "    return"}},
+		{[]string{"if x {", "}"}, "ox\x1b", []string{"if x {", "    x", "}"}},
+		{[]string{"  a"}, "ob\x1b", []string{"  a", "  b"}},
+		{[]string{"func f() {"}, "o\x1b", []string{"func f() {", ""}},
+		{[]string{"if x {", "    a"}, "jo}\x1b", []string{"if x {", "    a", "}"}},
+		{[]string{"    a"}, "o}\x1b", []string{"    a", "}"}},
+		{[]string{"f() {}"}, "f}i\r\x1b", []string{"f() {", "", "}"}},
+		{[]string{"if x {", "        "}, "jlli}\x1b", []string{"if x {", "}"}},
+		{[]string{"    }"}, "Ox\x1b", []string{"        x", "    }"}},
+		{[]string{"  a"}, "Ob\x1b", []string{"  b", "  a"}},
+		{[]string{"  a"}, "O\x1b", []string{"", "  a"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q on %q = %q, want %q", test.keys, test.lines, got, test.want)
+		}
+	}
+}
+
+func TestIndentOptions(t *testing.T) {
+	keep_options(t)
+	saved := file_extension
+	t.Cleanup(func() { file_extension = saved })
+	options.expandTab, options.tabWidth = true, 4
+	tests := []struct {
+		extension   string
+		autoIndent  bool
+		smartIndent bool
+		want        string
+	}{
+		{"go", true, true, "      x"},
+		{"go", true, false, "  x"},
+		{"go", false, true, "x"},
+		{"txt", true, true, "  x"},
+		{"py", true, true, "      x"},
+	}
+	for _, test := range tests {
+		file_extension = test.extension
+		options.autoIndent, options.smartIndent = test.autoIndent, test.smartIndent
+		set_buffer("  f(x):")
+		if test.extension == "go" {
+			set_buffer("  f(x) {")
+		}
+		run_keys(t, "ox\x1b")
+		if got := string(text_buffer[1]); got != test.want {
+			t.Errorf("new line in .%s with ai=%v si=%v = %q, want %q", test.extension, test.autoIndent, test.smartIndent, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// copy_rows returns a copy of rows first to last.
+func copy_rows(first, last int) [][]rune {
+	lines := make([][]rune, 0, last-first+1)
+	for row := first; row <= last; row++ {
+		lines = append(lines, append([]rune{}, text_buffer[row]...))
+	}
+	return lines
+}
+
+// line_command_rows returns the rows a line command acts on: the selected
+// ones in VISUAL mode, otherwise count lines from the cursor.
+func line_command_rows(count int) (int, int) {
+	if mode == 4 {
+		return min(selectionStart.row, selectionEnd.row), max(selectionStart.row, selectionEnd.row)
+	}
+	return currentRow, min(currentRow+count-1, len(text_buffer)-1)
+}
+
+// move_lines moves rows first to last down by delta rows, or up when delta
+// is negative, stopping at either end of the buffer. The cursor and marks
+// move along with the lines.
+func move_lines(first, last, delta int) {
+	delta = max(min(delta, len(text_buffer)-1-last), -first)
+	if delta == 0 {
+		return
+	}
+	push_buffer()
+	lines := copy_rows(first, last)
+	if delta > 0 {
+		copy(text_buffer[first:], text_buffer[last+1:last+1+delta])
+	} else {
+		copy(text_buffer[first+delta+len(lines):], text_buffer[first+delta:first])
+	}
+	copy(text_buffer[first+delta:], lines)
+	marks_lines_moved(first, last, delta)
+	currentRow += delta
+	if mode == 4 {
+		selectionStart.row += delta
+		selectionEnd.row += delta
+	}
+	modified = 0
+}
+
+// duplicate_lines puts a copy of rows first to last count times below
+// them, or above them, leaving the cursor on the first copy.
+func duplicate_lines(first, last, count int, above bool) {
+	push_buffer()
+	lines := [][]rune{}
+	for i := 0; i < max(count, 1); i++ {
+		lines = append(lines, copy_rows(first, last)...)
+	}
+	at := last + 1
+	if above {
+		at = first
+	}
+	insert_lines(at, lines)
+	// The cursor goes to its line's first copy, which takes the original's
+	// place when copying above
+	if !above {
+		currentRow += last - first + 1
+	}
+	modified = 0
+}
+
+// join_lines joins rows first to last into one line. With spaces, as J
+// does, blanks at the end of the line and the indentation of the line
+// joined to it are replaced by a single space, or none before a closing
+// bracket or when either side is empty; without, as gJ does, the lines are
+// joined as they are.
+func join_lines(first, last int, spaces bool) {
+	last = min(last, len(text_buffer)-1)
+	if last <= first {
+		return
+	}
+	push_buffer()
+	line := text_buffer[first]
+	for row := first + 1; row <= last; row++ {
+		next := text_buffer[first+1]
+		if spaces {
+			line = []rune(strings.TrimRight(string(line), " \t"))
+			next = next[len(leading_blanks(next)):]
+			if len(line) > 0 && len(next) > 0 && next[0] != ')' && next[0] != ']' && next[0] != '}' {
+				line = append(line, ' ')
+			}
+		}
+		currentCol = max(len(line)-1, 0)
+		marks_line_joined(first, len(line))
+		line = append(line, next...)
+		text_buffer[first] = line
+		text_buffer = append(text_buffer[:first+1], text_buffer[first+2:]...)
+	}
+	currentRow = first
+	modified = 0
+}
+
+// sort_lines implements :sort on rows first to last. args holds the flags,
+// any of i (ignore case), n (by the first number on the line), u (drop
+// duplicates) and r (by the text matching the pattern rather than what
+// follows it), a column to sort from and a /pattern/. reverse comes from
+// :sort!.
+func sort_lines(first, last int, args string, reverse bool) error {
+	var ignoreCase, numeric, unique, byMatch bool
+	var pattern *regexp.Regexp
+	column := 0
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		switch ch := args[0]; {
+		case ch == 'i':
+			ignoreCase = true
+		case ch == 'n':
+			numeric = true
+		case ch == 'u':
+			unique = true
+		case ch == 'r':
+			byMatch = true
+		case ch >= '0' && ch <= '9':
+			end := strings.IndexFunc(args, func(r rune) bool { return r < '0' || r > '9' })
+			if end < 0 {
+				end = len(args)
+			}
+			column, _ = strconv.Atoi(args[:end])
+			args = args[end:]
+			continue
+		case ch == '/':
+			end := strings.Index(args[1:], "/")
+			if end < 0 {
+				end = len(args) - 1
+			}
+			var err error
+			if pattern, err = regexp.Compile(args[1 : end+1]); err != nil {
+				return fmt.Errorf("invalid pattern: %s", args[1:end+1])
+			}
+			args = args[min(end+2, len(args)):]
+			continue
+		default:
+			return fmt.Errorf("invalid argument: %s", args)
+		}
+		args = args[1:]
+	}
+	if ignoreCase && pattern != nil {
+		pattern = regexp.MustCompile("(?i)" + pattern.String())
+	}
+
+	// key is the part of a line the lines are compared on
+	key := func(line []rune) string {
+		text := string(line)
+		if column > 0 {
+			text = string(line[min(column-1, len(line)):])
+		}
+		if pattern != nil {
+			if match := pattern.FindStringIndex(text); match == nil {
+				text = ""
+			} else if byMatch {
+				text = text[match[0]:match[1]]
+			} else {
+				text = text[match[1]:]
+			}
+		}
+		if ignoreCase {
+			text = strings.ToLower(text)
+		}
+		return text
+	}
+	numberPattern := regexp.MustCompile(`-?\d+(\.\d+)?`)
+	number := func(text string) (float64, bool) {
+		match := numberPattern.FindString(text)
+		if match == "" {
+			return 0, false
+		}
+		value, err := strconv.ParseFloat(match, 64)
+		return value, err == nil
+	}
+
+	lines := copy_rows(first, last)
+	keys := make([]string, len(lines))
+	for i, line := range lines {
+		keys[i] = key(line)
+	}
+	order := make([]int, len(lines))
+	for i := range order {
+		order[i] = i
+	}
+	// Lines without a number sort before the others, as in vim
+	less := func(a, b int) bool {
+		if numeric {
+			x, xOk := number(keys[a])
+			y, yOk := number(keys[b])
+			if xOk != yOk {
+				return !xOk
+			}
+			return x < y
+		}
+		return keys[a] < keys[b]
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if reverse {
+			return less(order[j], order[i])
+		}
+		return less(order[i], order[j])
+	})
+
+	sorted := make([][]rune, 0, len(lines))
+	for i, index := range order {
+		if unique && i > 0 && !less(order[i-1], index) && !less(index, order[i-1]) {
+			continue
+		}
+		sorted = append(sorted, lines[index])
+	}
+	push_buffer()
+	copy(text_buffer[first:], sorted)
+	delete_lines(first+len(sorted), last)
+	currentRow, currentCol = first, 0
+	modified = 0
+	return nil
+}
+
+// uniq_lines implements :uniq, deleting every line among rows first to
+// last that repeats an earlier one, comparing without case when
+// ignoreCase is set.
+func uniq_lines(first, last int, ignoreCase bool) {
+	seen := map[string]bool{}
+	duplicates := []int{}
+	for row := first; row <= last; row++ {
+		text := string(text_buffer[row])
+		if ignoreCase {
+			text = strings.Map(unicode.ToLower, text)
+		}
+		if seen[text] {
+			duplicates = append(duplicates, row)
+		}
+		seen[text] = true
+	}
+	if len(duplicates) == 0 {
+		return
+	}
+	push_buffer()
+	for i := len(duplicates) - 1; i >= 0; i-- {
+		delete_lines(duplicates[i], duplicates[i])
+	}
+	currentRow, currentCol = min(first, len(text_buffer)-1), 0
+	statusMessage = fmt.Sprintf("%d duplicate lines removed", len(duplicates))
+	modified = 0
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSortLines(t *testing.T) {
+	tests := []struct {
+		lines   []string
+		args    string
+		reverse bool
+		want    []string
+	}{
+		{[]string{"b", "c", "a"}, "", false, []string{"a", "b", "c"}},
+		{[]string{"b", "c", "a"}, "", true, []string{"c", "b", "a"}},
+		{[]string{"b", "A", "a", "B"}, "", false, []string{"A", "B", "a", "b"}},
+		{[]string{"b", "A", "a", "B"}, "i", false, []string{"A", "a", "b", "B"}},
+		{[]string{"x10", "x9", "none", "x-1"}, "n", false, []string{"none", "x-1", "x9", "x10"}},
+		{[]string{"a", "b", "a", "b"}, "u", false, []string{"a", "b"}},
+		{[]string{"1 z", "2 y", "3 x"}, "/\\d /", false, []string{"3 x", "2 y", "1 z"}},
+		{[]string{"z1", "y3", "x2"}, "/\\d/ r", false, []string{"z1", "x2", "y3"}},
+		{[]string{"az", "by", "cx"}, "2", false, []string{"cx", "by", "az"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		if err := sort_lines(0, len(test.lines)-1, test.args, test.reverse); err != nil {
+			t.Errorf("sort %q of %q: %v", test.args, test.lines, err)
+			continue
+		}
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("sort %q of %q = %q, want %q", test.args, test.lines, got, test.want)
+		}
+	}
+}
+
+func TestSortLinesRange(t *testing.T) {
+	set_buffer("keep", "c", "a", "b", "keep")
+	if err := sort_lines(1, 3, "", false); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"keep", "a", "b", "c", "keep"}
+	if got := buffer_lines(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSortLinesInvalid(t *testing.T) {
+	for _, args := range []string{"x", "/(/"} {
+		set_buffer("b", "a")
+		if err := sort_lines(0, 1, args, false); err == nil {
+			t.Errorf("sort %q: no error", args)
+		}
+	}
+}
+
+func TestUniqLines(t *testing.T) {
+	tests := []struct {
+		lines      []string
+		ignoreCase bool
+		want       []string
+	}{
+		{[]string{"a", "a", "b"}, false, []string{"a", "b"}},
+		{[]string{"a", "b", "a", "c", "b"}, false, []string{"a", "b", "c"}},
+		{[]string{"a", "A"}, false, []string{"a", "A"}},
+		{[]string{"a", "A"}, true, []string{"a"}},
+		{[]string{"x", "y"}, false, []string{"x", "y"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		uniq_lines(0, len(test.lines)-1, test.ignoreCase)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("uniq of %q = %q, want %q", test.lines, got, test.want)
+		}
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	tests := []struct {
+		lines  []string
+		spaces bool
+		want   string
+	}{
+		{[]string{"a", "b"}, true, "a b"},
+		{[]string{"a", "    b"}, true, "a b"},
+		{[]string{"a  ", "\tb"}, true, "a b"},
+		{[]string{"f(", ")"}, true, "f()"},
+		{[]string{"", "b"}, true, "b"},
+		{[]string{"a", "b", "c"}, true, "a b c"},
+		{[]string{"a", "  b"}, false, "a  b"},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		join_lines(0, len(test.lines)-1, test.spaces)
+		if got := strings.Join(buffer_lines(), "\n"); got != test.want {
+			t.Errorf("join %q = %q, want %q", test.lines, got, test.want)
+		}
+	}
+}
+
+// run_key_notation is run_keys for keys written as in a macro, such as
+// "<M-j>" for Alt+J.
+func run_key_notation(t *testing.T, keys string) {
+	t.Helper()
+	pendingInput = append(pendingInput, parse_keys(keys)...)
+	run_keys(t, "")
+}
+
+func TestLineKeys(t *testing.T) {
+	tests := []struct {
+		keys string
+		want []string
+		row  int
+	}{
+		{"<M-j>", []string{"b", "a", "c"}, 1},
+		{"2<M-j>", []string{"b", "c", "a"}, 2},
+		{"j<M-k>", []string{"b", "a", "c"}, 0},
+		{"<M-k>", []string{"a", "b", "c"}, 0},
+		{"Vj<M-j>", []string{"c", "a", "b"}, 2},
+		{"<M-J>", []string{"a", "a", "b", "c"}, 1},
+		{"2<M-J>", []string{"a", "a", "a", "b", "c"}, 1},
+		{"j<M-K>", []string{"a", "b", "b", "c"}, 1},
+		{"Vj<M-J>", []string{"a", "b", "a", "b", "c"}, 3},
+		{"J", []string{"a b", "c"}, 0},
+		{"3J", []string{"a b c"}, 0},
+		{"VjjJ", []string{"a b c"}, 0},
+		{"jgJ", []string{"a", "bc"}, 1},
+		{"J.", []string{"a b c"}, 0},
+		{"ix<M-j>", []string{"xa", "b", "c"}, 1},
+		{"ix<M-o>y<Esc>", []string{"xa", "y", "b", "c"}, 1},
+	}
+	for _, test := range tests {
+		set_buffer("a", "b", "c")
+		lastChange = nil
+		run_key_notation(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) || currentRow != test.row {
+			t.Errorf("%s = %q on row %d, want %q on row %d", test.keys, got, currentRow, test.want, test.row)
+		}
+	}
+}
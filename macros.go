@@ -0,0 +1,73 @@
+package main
+
+import "github.com/nsf/termbox-go"
+
+var (
+	// macroRegister is the register q is recording keys into, or 0.
+	macroRegister rune
+	macroKeys     []input_event
+	lastMacro     rune
+)
+
+// is_macro_register reports whether q can record into name. Only the named
+// registers are saved in ~/.onyxinfo, so only they hold macros.
+func is_macro_register(name rune) bool {
+	return name >= 'a' && name <= 'z' || name >= 'A' && name <= 'Z'
+}
+
+// start_recording reads a register name after q and starts recording every
+// key typed into it, where an uppercase name appends to the register.
+func start_recording() {
+	name := key_char(get_pending_key())
+	if !is_macro_register(name) {
+		return
+	}
+	macroRegister = name
+	macroKeys = nil
+}
+
+// record_macro_key adds a key typed on the keyboard to the macro being
+// recorded. Keys replayed from a macro or . are not recorded again.
+func record_macro_key(event input_event) {
+	if macroRegister != 0 && event.Type == termbox.EventKey {
+		macroKeys = append(macroKeys, event)
+	}
+}
+
+// stop_recording stores the recorded keys in the register as text in key
+// notation, so the macro can be pasted, edited and yanked back.
+func stop_recording() {
+	// Leave out the q that stopped the recording
+	keys := macroKeys[:max(len(macroKeys)-1, 0)]
+	text := []rune(key_notation(keys))
+	name := macroRegister
+	if name >= 'A' && name <= 'Z' {
+		name += 'a' - 'A'
+		text = append(append([]rune{}, registers[name].text...), text...)
+	}
+	registers[name] = register{text: text}
+	macroRegister = 0
+	macroKeys = nil
+	if err := save_info(); err != nil {
+		statusMessage = err.Error()
+	}
+}
+
+// play_macro reads a register name after @ and replays its keys count
+// times, where @@ replays the last macro played.
+func play_macro(count int) {
+	name := key_char(get_pending_key())
+	if name == '@' {
+		name = lastMacro
+	}
+	if !is_register(name) {
+		return
+	}
+	lastMacro = name
+	keys := parse_keys(string(get_register(name).text))
+	queue := []input_event{}
+	for i := 0; i < max(count, 1); i++ {
+		queue = append(queue, keys...)
+	}
+	pendingInput = append(queue, pendingInput...)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyNotation(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"dw", "dw"},
+		{"ia<lt>b<Esc>", "ia<lt>b<Esc>"},
+		{"a<b", "a<lt>b"},
+		{"<bogus>x", "<lt>bogus>x"},
+		{"<C-r><CR><Tab><BS>", "<C-r><CR><Tab><BS>"},
+		{"x y\nz", "x y<CR>z"},
+	}
+	for _, test := range tests {
+		if got := key_notation(parse_keys(test.text)); got != test.want {
+			t.Errorf("key_notation(parse_keys(%q)) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestRecordMacro(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	registers = map[rune]register{}
+	set_buffer("")
+
+	// Keys typed on the keyboard are recorded as get_key reads them
+	pendingInput = key_events("a")
+	start_recording()
+	for _, event := range parse_keys("dwi<lt>x<Esc>q") {
+		record_macro_key(event)
+	}
+	stop_recording()
+	if got := string(registers['a'].text); got != "dwi<lt>x<Esc>" {
+		t.Errorf("recorded %q", got)
+	}
+
+	pendingInput = key_events("A")
+	start_recording()
+	for _, event := range parse_keys("jq") {
+		record_macro_key(event)
+	}
+	stop_recording()
+	if got := string(registers['a'].text); got != "dwi<lt>x<Esc>j" {
+		t.Errorf("recorded with qA %q", got)
+	}
+	registers = map[rune]register{}
+	load_info()
+	if got := string(registers['a'].text); got != "dwi<lt>x<Esc>j" {
+		t.Errorf("saved %q", got)
+	}
+
+	run_keys(t, "q1")
+	if macroRegister != 0 {
+		t.Errorf("q1 started recording into %q", macroRegister)
+		macroRegister = 0
+	}
+}
+
+func TestPlayMacro(t *testing.T) {
+	tests := []struct {
+		macro string
+		lines []string
+		keys  string
+		want  []string
+	}{
+		{"dw", []string{"a b c d"}, "@a", []string{"b c d"}},
+		{"dw", []string{"a b c d"}, "2@a", []string{"c d"}},
+		{"dw", []string{"a b c d"}, "@a@@", []string{"c d"}},
+		{"$i!<Esc>j", []string{"a", "b", "c"}, "2@a", []string{"a!", "b!", "c"}},
+		{"$i<lt><Esc>", []string{"a"}, "@a", []string{"a<"}},
+		{"jdd", []string{"1", "2", "3", "4"}, "5@a", []string{"1", "3"}},
+		{"", []string{"a b"}, "@adw", []string{"b"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		registers = map[rune]register{'a': {text: []rune(test.macro)}}
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s with \"a = %q on %q = %q, want %q", test.keys, test.macro, strings.Join(test.lines, "|"), got, test.want)
+		}
+	}
+}
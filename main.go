@@ -9,8 +9,8 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"unicode"
 
-	"github.com/atotto/clipboard"
 	"github.com/mattn/go-runewidth"
 	"github.com/nsf/termbox-go"
 )
@@ -18,6 +18,7 @@ import (
 var (
 	ROWS, COLS             int
 	offsetRow, offsetCol   int
+	offsetWrap             int
 	currentCol, currentRow int
 	source_file            string
 	source_file2           string
@@ -25,7 +26,6 @@ var (
 	text_buffer            [][]rune = [][]rune{}
 	undoStack              []EditorState
 	redoStack              []EditorState
-	copy_buffer            []rune = []rune{}
 	modified               int
 	searchHighlights       []struct{ row, startCol, endCol int }
 	searchQuery            string
@@ -35,7 +35,11 @@ var (
 	bytesWritten           int = 0
 	selectionStart         struct{ row, col int }
 	selectionEnd           struct{ row, col int }
-	lineNumberWidth        int = 5
+	lineNumberWidth        int
+	pendingKeys            string
+	statusMessage          string
+	preferredCol           int
+	keepPreferredCol       bool
 )
 
 type EditorState struct {
@@ -48,7 +52,7 @@ type EditorState struct {
 
 const (
 	maxUndoLevels int = 500
-	tabWidth      int = 1
+	maxCount      int = 99999
 )
 
 func findText() {
@@ -56,15 +60,26 @@ func findText() {
 	searchQuery = ""
 	mode = 2
 	highlightIndex := 0
+	origin := cursor()
+	// Searching is a jump once the cursor has landed somewhere else
+	defer func() {
+		if cursor() != origin {
+			jumped := cursor()
+			currentRow, currentCol = origin.row, origin.col
+			record_jump()
+			currentRow, currentCol = jumped.row, jumped.col
+		}
+	}()
 
 	for {
 		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+		update_size()
 		display_text_buffer()
 		print_message(0, ROWS, termbox.ColorWhite, termbox.ColorDefault, " "+string('\ue23e')+"  "+string('\uf002')+" SEARCH: "+searchQuery+" ")
-		termbox.SetCursor(len("  SEARCH: ")+len(searchQuery)+4, ROWS)
+		termbox.SetCursor(len("  SEARCH: ")+runewidth.StringWidth(searchQuery)+4, ROWS)
 		termbox.Flush()
 
-		ev := termbox.PollEvent()
+		ev := get_key()
 		switch ev.Type {
 		case termbox.EventKey:
 			switch ev.Key {
@@ -76,6 +91,9 @@ func findText() {
 				searchHighlights = []struct{ row, startCol, endCol int }{}
 				return
 			case termbox.KeyEnter:
+				if len(searchHighlights) == 0 {
+					abort_pending_input()
+				}
 				if len(searchHighlights) > 0 && searchQuery != "" {
 					if highlightIndex >= len(searchHighlights) {
 						highlightIndex = 0 // Loop back to the start if at the end
@@ -88,27 +106,34 @@ func findText() {
 				}
 			case termbox.KeyBackspace, termbox.KeyBackspace2:
 				if len(searchQuery) > 0 {
-					searchQuery = searchQuery[:len(searchQuery)-1]
+					runes := []rune(searchQuery)
+					searchQuery = string(runes[:prev_grapheme(runes, len(runes))])
 				}
 			default:
 				if ev.Ch != 0 {
 					searchQuery += string(ev.Ch)
 				} else if ev.Key == termbox.KeySpace {
 					searchQuery += " "
+				} else if ev.Key == keyPaste {
+					searchQuery += pasted_line(ev)
 				}
 			}
 		}
 
 		if searchQuery != "" {
 			searchHighlights = []struct{ row, startCol, endCol int }{}
-			lowerSearchQuery := strings.ToLower(searchQuery)
+			lowerSearchQuery := []rune(strings.ToLower(searchQuery))
 
 			for i, line := range text_buffer {
-				lineStr := string(line)
-				lowerLineStr := strings.ToLower(lineStr)
+				// Search rune by rune so highlight columns are rune indexes
+				// rather than byte offsets into the UTF-8 string
+				lowerLine := make([]rune, len(line))
+				for j, r := range line {
+					lowerLine[j] = unicode.ToLower(r)
+				}
 				index := 0
 				for {
-					startIndex := strings.Index(lowerLineStr[index:], lowerSearchQuery)
+					startIndex := index_runes(lowerLine[index:], lowerSearchQuery)
 					if startIndex == -1 {
 						break
 					}
@@ -142,6 +167,16 @@ func findText() {
 	}
 }
 
+// index_runes returns the index of the first instance of substr in s, or -1.
+func index_runes(s, substr []rune) int {
+	for i := 0; i+len(substr) <= len(s); i++ {
+		if string(s[i:i+len(substr)]) == string(substr) {
+			return i
+		}
+	}
+	return -1
+}
+
 func ClearScreen() {
 	if runtime.GOOS == "windows" {
 		cmd := exec.Command("cmd", "/c", "cls")
@@ -217,33 +252,78 @@ func read_file(filename string) {
 	}
 }
 
+// open_file replaces the buffer with filename, saving the marks of the file
+// being left first.
+func open_file(filename string) {
+	save_info()
+	source_file = filename
+	source_file2 = strings.ReplaceAll(source_file, "/", "")
+	text_buffer = [][]rune{}
+	read_file(filename)
+	forget_bracket_matches()
+	undoStack, redoStack = nil, nil
+	currentRow, currentCol = 0, 0
+	offsetRow, offsetCol, offsetWrap = 0, 0, 0
+	modified = 1
+	marks = map[rune]position{}
+	jumpList, jumpIndex = nil, 0
+	load_file_marks(read_info())
+}
+
 func insert_rune(event termbox.Event) {
 	push_buffer()
-	insert_rune := make([]rune, len(text_buffer[currentRow])+1)
-	copy(insert_rune[:currentCol], text_buffer[currentRow][:currentCol])
 	if event.Key == termbox.KeySpace {
-		insert_rune[currentCol] = rune(' ')
+		insert_runes([]rune{' '})
 	} else if event.Key == termbox.KeyTab {
-		for i := 0; i < tabWidth; i++ {
-			insert_rune[currentCol] = rune(' ')
+		if options.expandTab {
+			vcol := visual_col(text_buffer[currentRow], currentCol)
+			insert_runes([]rune(strings.Repeat(" ", options.tabWidth-vcol%options.tabWidth)))
+		} else {
+			insert_runes([]rune{'\t'})
 		}
-	} else {
-		insert_rune[currentCol] = rune(event.Ch)
+	} else if !type_pair(event.Ch) {
+		dedent_closer(event.Ch)
+		insert_runes([]rune{event.Ch})
 	}
-	copy(insert_rune[currentCol+1:], text_buffer[currentRow][currentCol:])
+}
+
+// insert_runes inserts runes at the cursor on the current row and moves the
+// cursor past them. Callers are responsible for push_buffer.
+func insert_runes(runes []rune) {
+	insert_rune := make([]rune, len(text_buffer[currentRow])+len(runes))
+	copy(insert_rune[:currentCol], text_buffer[currentRow][:currentCol])
+	copy(insert_rune[currentCol:], runes)
+	copy(insert_rune[currentCol+len(runes):], text_buffer[currentRow][currentCol:])
 	text_buffer[currentRow] = insert_rune
-	currentCol++
+	currentCol += len(runes)
 }
 
 func delete_rune() {
 	push_buffer()
-	if currentCol > 0 {
-		currentCol--
-		delete_line := make([]rune, len(text_buffer[currentRow])-1)
+	if sts := soft_tab_stop(); sts > 0 && currentCol > 0 && is_indentation(text_buffer[currentRow][:currentCol]) {
+		// Backspace over indentation removes spaces back to the previous soft
+		// tab stop, so an expanded tab is deleted as a unit.
+		line := text_buffer[currentRow]
+		target := (visual_col(line, currentCol) - 1) / sts * sts
+		start := currentCol - 1
+		for start > 0 && line[start-1] == ' ' && visual_col(line, start-1) >= target {
+			start--
+		}
+		if line[currentCol-1] == '\t' {
+			start = currentCol - 1
+		}
+		text_buffer[currentRow] = append(line[:start:start], line[currentCol:]...)
+		currentCol = start
+	} else if currentCol > 0 {
+		// Delete the whole character, including any combining marks
+		end := currentCol
+		currentCol = prev_grapheme(text_buffer[currentRow], currentCol)
+		delete_line := make([]rune, len(text_buffer[currentRow])-(end-currentCol))
 		copy(delete_line[:currentCol], text_buffer[currentRow][:currentCol])
-		copy(delete_line[currentCol:], text_buffer[currentRow][currentCol+1:])
+		copy(delete_line[currentCol:], text_buffer[currentRow][end:])
 		text_buffer[currentRow] = delete_line
 	} else if currentRow > 0 {
+		marks_line_joined(currentRow-1, len(text_buffer[currentRow-1]))
 		append_line := make([]rune, len(text_buffer[currentRow]))
 		copy(append_line, text_buffer[currentRow][currentCol:])
 		new_text_buffer := make([][]rune, len(text_buffer)-1)
@@ -263,12 +343,14 @@ func delete_right_rune() {
 	push_buffer()
 	if currentCol < len(text_buffer[currentRow]) {
 		// Delete the character at the current position
-		delete_line := make([]rune, len(text_buffer[currentRow])-1)
+		end := grapheme_end(text_buffer[currentRow], currentCol)
+		delete_line := make([]rune, len(text_buffer[currentRow])-(end-currentCol))
 		copy(delete_line[:currentCol], text_buffer[currentRow][:currentCol])
-		copy(delete_line[currentCol:], text_buffer[currentRow][currentCol+1:])
+		copy(delete_line[currentCol:], text_buffer[currentRow][end:])
 		text_buffer[currentRow] = delete_line
 	} else if currentRow < len(text_buffer)-1 {
 		// If at the end of a line, join with the next line
+		marks_line_joined(currentRow, len(text_buffer[currentRow]))
 		append_line := make([]rune, len(text_buffer[currentRow+1]))
 		copy(append_line, text_buffer[currentRow+1])
 
@@ -287,15 +369,39 @@ func delete_right_rune() {
 	// Note: The cursor position doesn't change when deleting to the right
 }
 
+// is_indentation reports whether runes consist only of spaces and tabs.
+func is_indentation(runes []rune) bool {
+	for _, r := range runes {
+		if r != ' ' && r != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// insert_line splits the line at the cursor. With autoindent the new line
+// starts with the indentation new_line_indent gives it, one level less when
+// it starts with a closing bracket.
 func insert_line() {
 	push_buffer()
+	drop_auto_indent()
+	marks_line_split(currentRow, currentCol)
 	right_line := make([]rune, len(text_buffer[currentRow][currentCol:]))
 	copy(right_line, text_buffer[currentRow][currentCol:])
 	left_line := make([]rune, len(text_buffer[currentRow][:currentCol]))
 	copy(left_line, text_buffer[currentRow][:currentCol])
+	indent := new_line_indent(left_line)
+	if options.autoIndent {
+		right_line = right_line[len(leading_blanks(right_line)):]
+		if starts_dedent(right_line) {
+			indent = remove_indent_level(indent)
+		}
+	}
+	autoIndented = len(indent) > 0 && len(right_line) == 0
+	right_line = append(indent, right_line...)
 	text_buffer[currentRow] = left_line
 	currentRow++
-	currentCol = 0
+	currentCol = len(indent)
 	new_text_buffer := make([][]rune, len(text_buffer)+1)
 	copy(new_text_buffer, text_buffer[:currentRow])
 	new_text_buffer[currentRow] = right_line
@@ -303,127 +409,54 @@ func insert_line() {
 	text_buffer = new_text_buffer
 }
 
-func copy_line() {
-	copy_line := make([]rune, len(text_buffer[currentRow]))
-	copy(copy_line, text_buffer[currentRow])
-	copy_buffer = copy_line
-	write_to_clipboard(copy_line)
-}
-
-func copy_selection() {
-	if mode != 4 {
-		return
-	}
-
-	// Clear the existing copy buffer
-	copy_buffer = []rune{}
-
-	// Determine the start and end points of the selection
-	startRow, startCol := selectionStart.row, selectionStart.col
-	endRow, endCol := selectionEnd.row, selectionEnd.col
-
-	// Ensure start is before end
-	if startRow > endRow || (startRow == endRow && startCol > endCol) {
-		startRow, startCol, endRow, endCol = endRow, endCol, startRow, startCol
-	}
-
-	// Copy the selected text
-	for row := startRow; row <= endRow; row++ {
-		lineStart, lineEnd := 0, len(text_buffer[row])
-
-		if row == startRow {
-			lineStart = startCol
-		}
-		if row == endRow {
-			lineEnd = endCol
-		}
-
-		copy_buffer = append(copy_buffer, text_buffer[row][lineStart:lineEnd]...)
-
-		// Add a newline character if it's not the last line
-		if row < endRow {
-			copy_buffer = append(copy_buffer, '\n')
-		}
-	}
-
-	// Write to clipboard
-	write_to_clipboard(copy_buffer)
-}
-
-func paste_line() {
+// paste_line pastes value count times before the cursor: whole lines go
+// above the current line and other text goes in front of the cursor.
+func paste_line(value register, count int) {
 	push_buffer()
-	content, err := clipboard.ReadAll()
-	if err != nil {
-		return
-	}
-
-	var pasteContent []rune
-	if len(content) != 0 {
-		pasteContent = []rune(content)
-	} else if len(copy_buffer) != 0 {
-		pasteContent = copy_buffer
-	}
-
-	if len(pasteContent) != 0 {
-		new_text_buffer := make([][]rune, len(text_buffer)+1)
-		copy(new_text_buffer[:currentRow], text_buffer[:currentRow])
-		new_text_buffer[currentRow] = make([]rune, len(pasteContent))
-		copy(new_text_buffer[currentRow], pasteContent)
-		copy(new_text_buffer[currentRow+1:], text_buffer[currentRow:])
-		text_buffer = new_text_buffer
-		currentCol = 0
-		currentRow++
+	if value.linewise {
+		paste_lines(value.text, count, currentRow)
+	} else {
+		paste_text(value.text, count, cursor())
 	}
 }
 
-func paste_line_below() {
+// paste_line_below is paste_line for after the cursor.
+func paste_line_below(value register, count int) {
 	push_buffer()
-	content, err := clipboard.ReadAll()
-	if err != nil {
+	if value.linewise {
+		paste_lines(value.text, count, currentRow+1)
 		return
 	}
-
-	var pasteContent []rune
-	if len(content) != 0 {
-		pasteContent = []rune(content)
-	} else if len(copy_buffer) != 0 {
-		pasteContent = copy_buffer
+	p := cursor()
+	if p.col < len(text_buffer[p.row]) {
+		p.col = grapheme_end(text_buffer[p.row], p.col)
 	}
+	paste_text(value.text, count, p)
+}
 
-	if len(pasteContent) != 0 {
-		if currentRow < len(text_buffer) {
-			currentRow++
-		} else {
-			currentRow = len(text_buffer)
-		}
-		currentCol = 0
-		new_text_buffer := make([][]rune, len(text_buffer)+1)
-		copy(new_text_buffer[:currentRow], text_buffer[:currentRow])
-		new_text_buffer[currentRow] = make([]rune, len(pasteContent))
-		copy(new_text_buffer[currentRow], pasteContent)
-		copy(new_text_buffer[currentRow+1:], text_buffer[currentRow:])
-		text_buffer = new_text_buffer
+// paste_lines inserts count copies of the lines of text before row at and
+// puts the cursor on the first of them.
+func paste_lines(text []rune, count int, at int) {
+	lines := [][]rune{}
+	for i := 0; i < max(count, 1); i++ {
+		lines = append(lines, split_lines(text)...)
 	}
+	insert_lines(at, lines)
+	currentRow, currentCol = at, first_non_blank(at)
 }
 
-func cut_line() {
-	push_buffer()
-	copy_line()
-	if currentRow >= len(text_buffer) || len(text_buffer) < 1 {
-		return
+// paste_text inserts count copies of text at p. The cursor ends up on the
+// last character pasted, or where the paste starts if it spans lines.
+func paste_text(text []rune, count int, p position) {
+	repeated := []rune{}
+	for i := 0; i < max(count, 1); i++ {
+		repeated = append(repeated, text...)
 	}
-	if len(text_buffer) == 1 {
-		text_buffer = [][]rune{}
-	} else {
-		new_text_buffer := make([][]rune, len(text_buffer)-1)
-		copy(new_text_buffer[:currentRow], text_buffer[:currentRow])
-		copy(new_text_buffer[currentRow:], text_buffer[currentRow+1:])
-		text_buffer = new_text_buffer
+	end := insert_text(p, repeated)
+	currentRow, currentCol = p.row, p.col
+	if end.row == p.row && end.col > p.col {
+		currentCol = prev_grapheme(text_buffer[end.row], end.col)
 	}
-	if currentRow >= len(text_buffer) {
-		currentRow = len(text_buffer) - 1
-	}
-	currentCol = min(currentCol, len(text_buffer[currentRow]))
 }
 
 func push_buffer() {
@@ -439,6 +472,7 @@ func push_buffer() {
 		copy(state.buffer[i], text_buffer[i])
 	}
 	undoStack = append(undoStack, state)
+	changeCount++
 
 	// Limit the undo stack size
 	if len(undoStack) > maxUndoLevels {
@@ -468,11 +502,10 @@ func pull_buffer() {
 	offsetCol = lastState.offsetCol
 
 	undoStack = undoStack[:len(undoStack)-1]
+	forget_bracket_matches()
 }
 
 func jumpToLine(initialLineNumber *int) {
-	mode = 3
-
 	if initialLineNumber != nil {
 		// Jump to the initial line directly
 		lineNumber := *initialLineNumber
@@ -495,20 +528,21 @@ func jumpToLine(initialLineNumber *int) {
 				offsetRow = 0
 			}
 		}
-		mode = 0
 		return
 	}
 
 	// Handle interactive input if no initial line number is provided
+	mode = 3
 	lineNumberStr := ""
 	for {
 		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+		update_size()
 		display_text_buffer()
 		print_message(0, ROWS, termbox.ColorWhite, termbox.ColorDefault, " "+string('\ue23e')+" Jump to line: "+lineNumberStr)
 		termbox.SetCursor(len("Jump to line: ")+len(lineNumberStr)+3, ROWS)
 		termbox.Flush()
 
-		ev := termbox.PollEvent()
+		ev := get_key()
 		switch ev.Type {
 		case termbox.EventKey:
 			switch ev.Key {
@@ -517,6 +551,7 @@ func jumpToLine(initialLineNumber *int) {
 				return
 			case termbox.KeyEnter:
 				if lineNumber, err := strconv.Atoi(lineNumberStr); err == nil && lineNumber > 0 && lineNumber <= len(text_buffer) {
+					record_jump()
 					currentRow = lineNumber - 1
 					currentCol = 0
 
@@ -580,110 +615,165 @@ func write_file(filename string) {
 }
 
 func scroll_text_buffer() {
+	if ROWS < 1 {
+		return
+	}
+	if options.wrap {
+		scroll_wrapped()
+		return
+	}
+	offsetWrap = 0
 	if currentRow < offsetRow {
 		offsetRow = currentRow
 	}
 
-	if currentCol < offsetCol {
-		offsetCol = currentCol
+	// offsetCol is measured in screen columns, so tabs scroll by their width
+	cursorCol := visual_col(text_buffer[currentRow], currentCol)
+	if cursorCol < offsetCol {
+		offsetCol = cursorCol
 	}
 
 	if currentRow >= offsetRow+ROWS {
 		offsetRow = currentRow - ROWS + 1
 	}
-	if currentCol >= offsetCol+COLS-lineNumberWidth {
-		offsetCol = currentCol - COLS + lineNumberWidth + 1
+	// Keep the whole of a wide character under the cursor on screen
+	cursorEnd := cursorCol + cursor_width(text_buffer[currentRow], currentCol)
+	if cursorEnd > offsetCol+text_width() {
+		offsetCol = cursorEnd - text_width()
 	}
 }
 
 func display_text_buffer() {
-	var row, col int
-
-	for row = 0; row < ROWS; row++ {
-		text_buffer_row := row + offsetRow
+	update_bracket_matches()
+	for row, screenLine := range layout_screen() {
+		text_buffer_row := screenLine.row
 
 		// Display line number
-		lineNumber := fmt.Sprintf("%*d", lineNumberWidth-1, text_buffer_row+1)
-		lineColor := termbox.ColorBlack
-		if currentRow == text_buffer_row {
-			lineColor = termbox.ColorLightGray
-		}
-		for i, ch := range lineNumber {
-			termbox.SetCell(i, row, ch, lineColor, termbox.ColorDefault)
+		if lineNumberWidth > 0 {
+			lineNumber := fmt.Sprintf("%*d", lineNumberWidth-1, text_buffer_row+1)
+			if screenLine.continuation {
+				lineNumber = strings.Repeat(" ", lineNumberWidth-1)
+			}
+			lineColor := termbox.ColorBlack
+			if currentRow == text_buffer_row {
+				lineColor = termbox.ColorLightGray
+			}
+			for i, ch := range lineNumber {
+				termbox.SetCell(i, row, ch, lineColor, termbox.ColorDefault)
+			}
+			termbox.SetCell(lineNumberWidth-1, row, '│', lineColor, termbox.ColorDefault)
 		}
-		termbox.SetCell(lineNumberWidth-1, row, '│', lineColor, termbox.ColorDefault)
 
 		if text_buffer_row < len(text_buffer) {
-			line := text_buffer[text_buffer_row]
-			visibleCol := 0   // Track the visible column on the screen
-			columnInLine := 0 // Track the current column in the line
-
-			for col = 0; col < COLS-lineNumberWidth && visibleCol < COLS-lineNumberWidth; col++ {
-				text_buffer_column := col + offsetCol
-
-				if text_buffer_column < len(line) {
-					ch := line[text_buffer_column]
-
-					// Check if this character is part of a search highlight
-					highlighted := false
-					for _, highlight := range searchHighlights {
-						if highlight.row == text_buffer_row &&
-							text_buffer_column >= highlight.startCol &&
-							text_buffer_column < highlight.endCol {
-							highlighted = true
-							break
-						}
-					}
-					isSelected := mode == 4 && isWithinSelection(text_buffer_row, text_buffer_column)
-					if ch == ' ' {
-						bgColor := termbox.ColorDefault
-						if highlighted {
-							bgColor = termbox.ColorYellow
-						}
-						if isSelected {
-							bgColor = termbox.ColorDarkGray
-						}
-						termbox.SetCell(visibleCol+lineNumberWidth, row, ' ', termbox.ColorDefault, bgColor)
-					}
-					if ch == '\t' {
-						// Calculate the number of spaces needed for the tab
-						spacesToAdd := tabWidth - (columnInLine % tabWidth)
-						bgColor := termbox.ColorDefault
-						if highlighted {
-							bgColor = termbox.ColorYellow
-						}
-						if isSelected {
-							bgColor = termbox.ColorDarkGray
-						}
-						for i := 0; i < spacesToAdd && visibleCol < COLS-lineNumberWidth; i++ {
-							termbox.SetCell(visibleCol+lineNumberWidth, row, ' ', termbox.ColorDefault, bgColor)
-							visibleCol++
-						}
-						columnInLine += spacesToAdd
-					} else {
-						fgColor := termbox.ColorDefault
-						bgColor := termbox.ColorDefault
-						if highlighted {
-							fgColor = termbox.ColorBlack
-							bgColor = termbox.ColorWhite
-						}
-						if isSelected {
-							fgColor = termbox.ColorBlack
-							bgColor = termbox.ColorDarkGray
-						}
-						termbox.SetCell(visibleCol+lineNumberWidth, row, ch, fgColor, bgColor)
-						visibleCol++
-						columnInLine++
-					}
-				}
+			if screenLine.continuation {
+				print_message(screenLine.x-runewidth.StringWidth(options.showBreak), row, termbox.ColorBlue, termbox.ColorDefault, options.showBreak)
 			}
-		} else if row+offsetRow > len(text_buffer)-1 {
+			display_line(row, screenLine)
+		} else {
 			termbox.SetCell(lineNumberWidth, row, '~', termbox.ColorBlue, termbox.ColorDefault)
 		}
 	}
 }
 
+// display_line draws the part of a text_buffer row described by screenLine
+// on screen row row.
+func display_line(row int, screenLine screen_line) {
+	text_buffer_row := screenLine.row
+	line := text_buffer[text_buffer_row]
+	startVcol, endVcol := screenLine.startVcol, screenLine.endVcol
+	lineCol := visual_col(line, screenLine.startCol) // Track the screen column within the whole line
+
+	for text_buffer_column := screenLine.startCol; text_buffer_column < screenLine.endCol && lineCol < endVcol; {
+		ch := line[text_buffer_column]
+		clusterEnd := grapheme_end(line, text_buffer_column)
+		width := cluster_width(line, text_buffer_column, clusterEnd, lineCol)
+		startCol := lineCol
+		lineCol += width
+		if lineCol <= startVcol {
+			text_buffer_column = clusterEnd
+			continue
+		}
+
+		// Check if this character is part of a search highlight
+		highlighted := false
+		for _, highlight := range searchHighlights {
+			if highlight.row == text_buffer_row &&
+				text_buffer_column >= highlight.startCol &&
+				text_buffer_column < highlight.endCol {
+				highlighted = true
+				break
+			}
+		}
+		isSelected := mode == 4 && isWithinSelection(text_buffer_row, text_buffer_column)
+		unbalanced, matched := bracket_highlight(position{text_buffer_row, text_buffer_column})
+		if ch == ' ' || ch == '\t' {
+			bgColor := termbox.ColorDefault
+			if highlighted {
+				bgColor = termbox.ColorYellow
+			}
+			if isSelected {
+				bgColor = termbox.ColorDarkGray
+			}
+			// A tab may be cut off by the left or right edge of the text area
+			for visibleCol := max(startCol, startVcol); visibleCol < lineCol && visibleCol < endVcol; visibleCol++ {
+				termbox.SetCell(visibleCol-startVcol+screenLine.x, row, ' ', termbox.ColorDefault, bgColor)
+			}
+		} else if startCol < startVcol || lineCol > endVcol {
+			// A wide character straddling either edge can't be drawn in
+			// halves, so mark the visible part of it instead
+			marker := '<'
+			if lineCol > endVcol {
+				marker = '>'
+			}
+			for visibleCol := max(startCol, startVcol); visibleCol < lineCol && visibleCol < endVcol; visibleCol++ {
+				termbox.SetCell(visibleCol-startVcol+screenLine.x, row, marker, termbox.ColorBlue, termbox.ColorDefault)
+			}
+		} else {
+			fgColor := termbox.ColorDefault
+			bgColor := termbox.ColorDefault
+			if unbalanced {
+				fgColor = termbox.ColorRed | termbox.AttrBold
+			}
+			if matched {
+				fgColor = termbox.ColorBlack
+				bgColor = termbox.ColorCyan
+			}
+			if highlighted {
+				fgColor = termbox.ColorBlack
+				bgColor = termbox.ColorWhite
+			}
+			if isSelected {
+				fgColor = termbox.ColorBlack
+				bgColor = termbox.ColorDarkGray
+			}
+			x := startCol - startVcol + screenLine.x
+			if is_control(ch) {
+				termbox.SetCell(x, row, '^', termbox.ColorBlue, bgColor)
+				termbox.SetCell(x+1, row, ch^0x40, termbox.ColorBlue, bgColor)
+			} else if runewidth.RuneWidth(ch) == 0 {
+				termbox.SetCell(x, row, '◌', fgColor, bgColor)
+			} else {
+				// Only the base rune is drawn; combining marks would
+				// otherwise be placed in cells of their own
+				termbox.SetCell(x, row, ch, fgColor, bgColor)
+			}
+		}
+		text_buffer_column = clusterEnd
+	}
+}
+
 func isWithinSelection(row, col int) bool {
+	switch visualKind {
+	case "V":
+		return row >= min(selectionStart.row, selectionEnd.row) && row <= max(selectionStart.row, selectionEnd.row)
+	case "<C-v>":
+		top, bottom, left, right := visual_block()
+		if row < top || row > bottom {
+			return false
+		}
+		span := block_span(row, left, right)
+		return col >= span.start && col < span.end
+	}
 	if selectionStart.row <= selectionEnd.row {
 		if row < selectionStart.row || row > selectionEnd.row {
 			return false
@@ -721,13 +811,18 @@ func display_status_bar() {
 		mode_status = " " + string('\ue23e') + " " + string('\uf002') + "  SEARCH: "
 	} else if mode == 3 {
 		mode_status = " " + string('\ue23e') + "  JUMP TO: "
+	} else if mode == 4 && visualKind == "V" {
+		mode_status = " " + string('\ue23e') + "  VISUAL LINE "
+	} else if mode == 4 && visualKind == "<C-v>" {
+		mode_status = " " + string('\ue23e') + "  VISUAL BLOCK "
 	} else if mode == 4 {
 		mode_status = " " + string('\ue23e') + "  VISUAL "
+	} else if mode == 5 {
+		mode_status = " " + string('\ue23e') + "  COMMAND "
 	} else {
 		mode_status = " " + string('\ue23e') + "  NORMAL "
 	}
 
-	filename_length := len(source_file)
 	switch file_extension {
 	case "astro":
 		logo = '\ue6b3'
@@ -845,26 +940,25 @@ func display_status_bar() {
 		logo = ''
 	}
 
-	if filename_length > 25 {
-		filename_length = 25
+	filename := source_file2
+	if runewidth.StringWidth(filename) > 25 {
+		filename = runewidth.Truncate(filename, 25, "")
 	}
+	name_status := string(logo) + " " + filename
 
-	filename_length = min(filename_length, len(source_file))
-
+	lines_status := " " + strconv.Itoa(len(text_buffer)) + " line"
 	if len(text_buffer) > 1 {
-		file_status = string(logo) + " " + source_file2[:filename_length] + " " + strconv.Itoa(len(text_buffer)) + " lines"
-	} else {
-		file_status = string(logo) + " " + source_file2[:filename_length] + " " + strconv.Itoa(len(text_buffer)) + " line"
+		lines_status += "s"
 	}
 	if modified == 0 {
-		file_status += " modified"
+		file_status = " modified"
 	} else if modified == 1 {
-		file_status += " oldest change"
+		file_status = " oldest change"
 	} else if modified == 2 {
 		if bytesWritten == 0 {
-			file_status += " saved 0 bytes"
+			file_status = " saved 0 bytes"
 		} else {
-			file_status += " saved " + strconv.Itoa(bytesWritten) + " bytes"
+			file_status = " saved " + strconv.Itoa(bytesWritten) + " bytes"
 			bytesWritten = 0
 		}
 	}
@@ -878,16 +972,88 @@ func display_status_bar() {
 	}
 
 	file_percent := string('\ue64e') + " " + strconv.Itoa((currentRow+1)*100/len(text_buffer)) + "%"
-	if len(copy_buffer) > 0 {
+	if len(registers['"'].text) > 0 {
 		copy_status = " [Copy]"
 	}
 	if len(undoStack) > 0 {
 		undo_status = " [Undo]"
 	}
-	used_space := len(mode_status) + len(file_status) + len(copy_status) + len(undo_status) + len(file_percent) + len(parent_status) + len("ROWS: "+strconv.Itoa(currentRow+1)+" COLS: "+strconv.Itoa(currentCol+1)) - 20
-	spaces := strings.Repeat(" ", COLS-used_space)
-	message := mode_status + file_status + copy_status + undo_status + spaces + parent_status + file_percent
-	print_message(0, ROWS, termbox.ColorWhite, termbox.ColorDefault, message)
+	var recording_status string
+	if macroRegister != 0 {
+		recording_status = " recording @" + string(macroRegister)
+	}
+	var pending_status string
+	if pendingKeys != "" {
+		pending_status = pendingKeys + "  "
+	}
+
+	// Lower priority numbers are more important and survive longer when the
+	// terminal is too narrow for everything
+	print_status_segments([]status_segment{
+		{text: mode_status, priority: 0, action: func() { mode = 0 }},
+		{text: recording_status, priority: 0},
+		{text: name_status, priority: 1},
+		{text: lines_status, priority: 5},
+		{text: file_status, priority: 2},
+		{text: copy_status, priority: 6},
+		{text: undo_status, priority: 4, action: pull_buffer},
+		{text: pending_status, priority: 0, right: true},
+		{text: parent_status, priority: 7, right: true},
+		{text: file_percent, priority: 3, right: true, action: func() { jumpToLine(nil) }},
+	})
+}
+
+type status_segment struct {
+	text     string
+	priority int
+	right    bool
+	action   func()
+}
+
+// print_status_segments draws the status bar, dropping the least important
+// segments until the rest fit in COLS and truncating what is left if even
+// the most important one doesn't. Left segments are drawn from column 0 and
+// right ones are aligned to the right edge.
+func print_status_segments(segments []status_segment) {
+	width := func() int {
+		total := 0
+		for _, segment := range segments {
+			total += runewidth.StringWidth(segment.text)
+		}
+		return total
+	}
+	for width() > COLS && len(segments) > 1 {
+		drop := 0
+		for i, segment := range segments {
+			if segment.priority > segments[drop].priority {
+				drop = i
+			}
+		}
+		segments = append(segments[:drop:drop], segments[drop+1:]...)
+	}
+	if width() > COLS {
+		segments[0].text = runewidth.Truncate(segments[0].text, max(COLS, 0), "")
+	}
+
+	clickRegions = nil
+	rightWidth := 0
+	for _, segment := range segments {
+		if segment.right {
+			rightWidth += runewidth.StringWidth(segment.text)
+		}
+	}
+	left, right := 0, COLS-rightWidth
+	for _, segment := range segments {
+		x := &left
+		if segment.right {
+			x = &right
+		}
+		print_message(*x, ROWS, termbox.ColorWhite, termbox.ColorDefault, segment.text)
+		if segment.action != nil {
+			add_click_region(ROWS, *x, segment.text, segment.action)
+		}
+		*x += runewidth.StringWidth(segment.text)
+	}
 }
 
 func print_message(column int, row int, fg termbox.Attribute, bg termbox.Attribute, message string) {
@@ -897,49 +1063,87 @@ func print_message(column int, row int, fg termbox.Attribute, bg termbox.Attribu
 	}
 }
 
-func get_key() termbox.Event {
-	var key_event termbox.Event
-	switch event := termbox.PollEvent(); event.Type {
-	case termbox.EventKey:
+func get_key() input_event {
+	if len(pendingInput) > 0 {
+		key_event := pendingInput[0]
+		pendingInput = pendingInput[1:]
+		record_key(key_event)
+		return key_event
+	}
+	var key_event input_event
+	switch event := poll_event(); event.Type {
+	case termbox.EventKey, termbox.EventMouse, termbox.EventResize:
 		key_event = event
 	case termbox.EventError:
 		panic(event.Err)
 	}
+	record_key(key_event)
+	record_macro_key(key_event)
 	return key_event
 }
 
+// get_pending_key reads the next key of a command that is still being
+// typed, first redrawing so the status bar shows pendingKeys.
+func get_pending_key() input_event {
+	for {
+		redraw()
+		if event := get_key(); event.Type != termbox.EventResize {
+			return event
+		}
+	}
+}
+
+// read_count reads a count typed before a command, starting with event, and
+// returns it with the first key after it. The count is 0 if none was typed,
+// and a leading '0' is the 0 motion rather than a count.
+func read_count(event input_event) (int, input_event) {
+	count, digits := 0, 0
+	for event.Ch >= '1' && event.Ch <= '9' || count > 0 && event.Ch == '0' {
+		count = min(count*10+int(event.Ch-'0'), maxCount)
+		digits++
+		pendingKeys += string(event.Ch)
+		event = get_pending_key()
+	}
+	record_count(count, digits)
+	return count, event
+}
+
 func write_to_clipboard(runes []rune) {
 	string_to_write := string(runes)
-	err := clipboard.WriteAll(string_to_write)
-	if err != nil {
-		return
-	}
+	clipboardText = string_to_write
+	copy_to_clipboard(string_to_write)
+}
+
+// exit_editor saves what ~/.onyxinfo keeps and leaves the editor.
+func exit_editor() {
+	save_info()
+	disable_bracketed_paste()
+	termbox.Close()
+	os.Exit(0)
 }
 
 func handle_close() {
 	if modified != 0 {
-		termbox.Close()
-		os.Exit(0)
+		exit_editor()
 	} else {
 		var answer string
 		for {
 			termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+			update_size()
 			display_text_buffer()
 			print_message(0, ROWS, termbox.ColorWhite, termbox.ColorDefault, " Would you like to save before leaving(y/n): "+answer)
 			termbox.SetCursor(len("Would you like to save before leaving (y/n): ")+len(answer), ROWS)
 			termbox.Flush()
 
-			ev := termbox.PollEvent()
+			ev := get_key()
 			if ev.Type == termbox.EventKey {
 				switch ev.Key {
 				case termbox.KeyEnter:
 					if answer == "y" {
 						write_file(source_file)
-						termbox.Close()
-						os.Exit(0)
+						exit_editor()
 					} else if answer == "n" {
-						termbox.Close()
-						os.Exit(0)
+						exit_editor()
 					}
 				case termbox.KeyBackspace, termbox.KeyBackspace2:
 					if len(answer) > 0 {
@@ -955,276 +1159,269 @@ func handle_close() {
 	}
 }
 
+// altCommands are the Alt keys NORMAL and VISUAL mode have commands for.
+var altCommands = map[string]bool{"<M-j>": true, "<M-k>": true, "<M-J>": true, "<M-K>": true}
+
+// escape_to_normal leaves INSERT or VISUAL mode for NORMAL mode, as Esc does.
+func escape_to_normal() {
+	if mode == 1 {
+		drop_auto_indent()
+	}
+	finish_block_insert()
+	end_visual()
+	mode = 0
+}
+
 func process_key_press() {
+	begin_change()
 	key_event := get_key()
-	if key_event.Key == termbox.KeyEsc {
-		mode = 0
-	} else if key_event.Ch != 0 {
-		if mode == 1 {
-			insert_rune(key_event)
-			modified = 0
-		} else {
-			switch key_event.Ch {
-			case 'q':
-				handle_close()
-			case 'i':
-				mode = 1
-			case 'v':
-				mode = 4
-				selectionStart.row = currentRow
-				selectionStart.col = currentCol
-				selectionEnd.row = currentRow
-				selectionEnd.col = currentCol
-			case 'w':
-				write_file(source_file)
-			case 'y':
-				if mode != 4 {
-					copy_line()
-				} else {
-					copy_selection()
-					mode = 0
-				}
-			case 'P':
-				paste_line()
-				modified = 0
-			case 'd':
-				if currentRow != 0 {
-					cut_line()
-					modified = 0
-				} else {
-				}
-			case 'u':
-				pull_buffer()
-			case 'p':
-				paste_line_below()
-				modified = 0
-			case '/':
-				findText()
-			case 'g':
-				jumpToLine(nil)
-			case 'k':
-				if mode != 4 {
-					if currentRow != 0 {
-						currentRow--
-					}
-				} else {
-					if currentRow != 0 {
-						currentRow--
-					}
-					selectionEnd.row = currentRow
-					selectionEnd.col = currentCol
-				}
+	if key_event.Type == termbox.EventResize {
+		// The main loop redraws with the new size straight away
+		return
+	}
+	statusMessage = ""
+	keepPreferredCol = false
+	defer func() {
+		if !keepPreferredCol {
+			preferredCol = visual_col(text_buffer[currentRow], currentCol)
+		}
+		end_change()
+	}()
+	if key_event.Type == termbox.EventMouse {
+		autoIndented = false
+		handle_mouse(key_event.Event)
+	} else if key_event.Key == keyPaste && mode != 1 {
+		end_visual()
+		insert_paste(key_event)
+	} else if key_event.Mod&termbox.ModAlt != 0 && (mode == 1 || !altCommands[key_name(key_event)]) {
+		// Terminals send Alt+key as ESC followed by the key, so an Alt key
+		// without a command of its own is Esc typed quickly before the key
+		escape_to_normal()
+		key_event.Mod &^= termbox.ModAlt
+		process_normal_key(key_event)
+	} else if key_event.Key == termbox.KeyEsc {
+		escape_to_normal()
+	} else if mode == 1 {
+		process_insert_key(key_event)
+	} else {
+		process_normal_key(key_event)
+	}
 
-			case 'j':
-				if mode != 4 {
-					if currentRow < len(text_buffer)-1 {
-						currentRow++
-					}
-				} else {
-					if currentRow < len(text_buffer)-1 {
-						currentRow++
-					}
-					selectionEnd.row = currentRow
-					selectionEnd.col = currentCol
-				}
-			case 'h':
-				if mode != 4 {
-					if currentCol != 0 {
-						currentCol--
-					} else if currentRow > 0 {
-						currentRow--
-						currentCol = len(text_buffer[currentRow])
-					}
-				} else {
-					if currentCol != 0 {
-						currentCol--
-					} else if currentRow > 0 {
-						currentRow--
-						currentCol = len(text_buffer[currentRow])
-					}
-					selectionEnd.row = currentRow
-					selectionEnd.col = currentCol
-				}
+	if currentCol > len(text_buffer[currentRow]) {
+		currentCol = len(text_buffer[currentRow])
+	}
+	if currentCol < 0 {
+		currentCol = 0
+	}
+	currentCol = grapheme_start(text_buffer[currentRow], currentCol)
+}
 
-			case 'l':
-				if mode != 4 {
-					if currentCol != len(text_buffer[currentRow]) {
-						currentCol++
-					} else if currentRow < len(text_buffer)-1 {
-						currentRow++
-						currentCol = 0
-					}
-				} else {
-					if currentCol != len(text_buffer[currentRow]) {
-						currentCol++
-					} else if currentRow < len(text_buffer)-1 {
-						currentRow++
-						currentCol = 0
-					}
-					selectionEnd.row = currentRow
-					selectionEnd.col = currentCol
-				}
+// process_insert_key handles a key typed in INSERT mode.
+func process_insert_key(key_event input_event) {
+	name := key_name(key_event)
+	if insertModeMotions[name] {
+		autoIndented = false
+		run_motion(name, 0)
+		return
+	}
+	if key_event.Ch != 0 {
+		insert_rune(key_event.Event)
+		modified = 0
+		return
+	}
+	switch key_event.Key {
+	case termbox.KeyCtrlS:
+		write_file(source_file)
+	case termbox.KeyCtrlV:
+		paste_in_insert()
+	case keyPaste:
+		insert_paste(key_event)
+	case termbox.KeyEnter:
+		if !open_block() {
+			insert_line()
+		}
+		modified = 0
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		if !delete_pair() {
+			delete_rune()
+		}
+		modified = 0
+	case termbox.KeyDelete:
+		delete_right_rune()
+		modified = 0
+	case termbox.KeyTab, termbox.KeySpace:
+		insert_rune(key_event.Event)
+		modified = 0
+	}
+}
 
-			case 't':
-				lineNumber := 1
-				jumpToLine(&lineNumber)
-			case 'b':
-				lineNumber := len(text_buffer)
-				jumpToLine(&lineNumber)
-			case 'o':
-				currentCol = len(text_buffer[currentRow])
-				insert_line()
-				modified = 0
-				mode = 1
-			}
+// process_normal_key handles a key typed in NORMAL or VISUAL mode: a motion
+// or a command, optionally after a count, where 'g' starts a two key name.
+func process_normal_key(key_event input_event) {
+	defer func() {
+		pendingKeys = ""
+		selectedRegister = 0
+	}()
+	count, key_event := read_count(key_event)
+	for key_event.Ch == '"' {
+		pendingKeys += `"`
+		name := key_char(get_pending_key())
+		if !is_register(name) {
+			return
+		}
+		selectedRegister = name
+		pendingKeys += string(name)
+		var registerCount int
+		registerCount, key_event = read_count(get_pending_key())
+		if registerCount > 0 {
+			count = min(max(count, 1)*registerCount, maxCount)
+		}
+	}
+	name := key_name(key_event)
+	if name == "g" {
+		pendingKeys += name
+		name += key_name(get_pending_key())
+	}
+	pendingKeys += name
+	if mode == 4 && (name == "x" || name == "<BS>" || name == "<Del>") {
+		// These delete the selection rather than moving
+		name = "d"
+	}
+	if run_motion(name, count) {
+		return
+	}
 
-			if currentCol > len(text_buffer[currentRow]) {
-				currentCol = len(text_buffer[currentRow])
-			}
-			if currentCol < 0 {
-				currentCol = 0
-			}
+	switch name {
+	case "<Esc>":
+		end_visual()
+	case "q":
+		if macroRegister != 0 {
+			stop_recording()
+		} else {
+			start_recording()
 		}
-	} else {
-		switch key_event.Key {
-		case termbox.KeyCtrlS:
-			write_file(source_file)
-		case termbox.KeyEnter:
-			if mode == 1 {
-				insert_line()
-				modified = 0
-			} else {
-				if currentRow < len(text_buffer)-1 {
-					currentRow++
-				}
-			}
-		case termbox.KeyBackspace:
-			if mode == 1 {
-				delete_rune()
-				modified = 0
-			} else {
-				if currentCol != 0 {
-					currentCol--
-				} else if currentRow > 0 {
-					currentRow--
-					currentCol = len(text_buffer[currentRow])
-				}
-			}
-		case termbox.KeyBackspace2:
-			if mode == 1 {
-				delete_rune()
-				modified = 0
-			} else {
-				if currentCol != 0 {
-					currentCol--
-				} else if currentRow > 0 {
-					currentRow--
-					currentCol = len(text_buffer[currentRow])
-				}
-			}
-		case termbox.KeyDelete:
-			if mode == 1 {
-				delete_right_rune()
-				modified = 0
-			} else {
-				if currentCol != len(text_buffer[currentRow]) {
-					currentCol++
-				} else if currentRow < len(text_buffer)-1 {
-					currentRow++
-					currentCol = 0
-				}
-			}
-		case termbox.KeyTab:
-			if mode == 1 {
-				for i := 0; i < tabWidth; i++ {
-					insert_rune(key_event)
-				}
-				modified = 0
-			}
-		case termbox.KeySpace:
-			if mode == 1 {
-				insert_rune(key_event)
-				modified = 0
-			}
-		case termbox.KeyHome:
-			currentCol = 0
-		case termbox.KeyEnd:
-			currentCol = len(text_buffer[currentRow])
-		case termbox.KeyPgup:
-			if currentRow-int(ROWS/4) > 0 {
-				currentRow -= int(ROWS / 4)
-			}
-		case termbox.KeyPgdn:
-			if currentRow+int(ROWS/4) < len(text_buffer)-1 {
-				currentRow += int(ROWS / 4)
-			}
-		case termbox.KeyArrowUp:
-			if mode != 4 {
-				if currentRow != 0 {
-					currentRow--
-				}
-			} else {
-				if currentRow != 0 {
-					currentRow--
-				}
-				selectionEnd.row = currentRow
-				selectionEnd.col = currentCol
-			}
-		case termbox.KeyArrowDown:
-			if mode != 4 {
-				if currentRow < len(text_buffer)-1 {
-					currentRow++
-				}
-			} else {
-				if currentRow < len(text_buffer)-1 {
-					currentRow++
-				}
-				selectionEnd.row = currentRow
-				selectionEnd.col = currentCol
-			}
-		case termbox.KeyArrowLeft:
-			if mode != 4 {
-				if currentCol != 0 {
-					currentCol--
-				} else if currentRow > 0 {
-					currentRow--
-					currentCol = len(text_buffer[currentRow])
-				}
-			} else {
-				if currentCol != 0 {
-					currentCol--
-				} else if currentRow > 0 {
-					currentRow--
-					currentCol = len(text_buffer[currentRow])
-				}
-				selectionEnd.row = currentRow
-				selectionEnd.col = currentCol
-			}
-		case termbox.KeyArrowRight:
-			if mode != 4 {
-				if currentCol != len(text_buffer[currentRow]) {
-					currentCol++
-				} else if currentRow < len(text_buffer)-1 {
-					currentRow++
-					currentCol = 0
-				}
-			} else {
-				if currentCol != len(text_buffer[currentRow]) {
-					currentCol++
-				} else if currentRow < len(text_buffer)-1 {
-					currentRow++
-					currentCol = 0
-				}
-				selectionEnd.row = currentRow
-				selectionEnd.col = currentCol
-			}
+	case "@":
+		play_macro(count)
+	case "m":
+		set_mark()
+	case "<C-o>":
+		jump_older(count)
+	case "<Tab>":
+		jump_newer(count)
+	case "i", "a":
+		if mode == 4 {
+			select_text_object(name, count)
+		} else if name == "i" {
+			mode = 1
 		}
-		if currentCol > len(text_buffer[currentRow]) {
-			currentCol = len(text_buffer[currentRow])
+	case "v", "V", "<C-v>":
+		start_visual(name)
+	case "gv":
+		reselect_visual()
+	case "P", "p":
+		if mode == 4 {
+			paste_over_selection(count)
+		} else {
+			paste(get_register(selectedRegister), count, name == "p")
 		}
-		if currentCol < 0 {
-			currentCol = 0
+	case "S":
+		if mode == 4 {
+			surround_selection()
+		}
+	case "<M-j>", "<M-k>":
+		first, last := line_command_rows(1)
+		delta := max(count, 1)
+		if name == "<M-k>" {
+			delta = -delta
+		}
+		move_lines(first, last, delta)
+	case "<M-J>", "<M-K>":
+		first, last := line_command_rows(1)
+		end_visual()
+		duplicate_lines(first, last, count, name == "<M-K>")
+	case "J", "gJ":
+		first, last := line_command_rows(max(count, 2))
+		end_visual()
+		join_lines(first, max(last, first+1), name == "J")
+	case "<C-p>":
+		cycle_paste(1)
+	case "<C-n>":
+		cycle_paste(-1)
+	case "d", "c", "y", ">", "<", "gu", "gU", "g~", "=", "gc":
+		if mode != 4 {
+			run_operator(name, count)
+		} else {
+			visual_operator(name, count)
+		}
+	case "U":
+		if mode == 4 {
+			visual_operator(name, count)
+		}
+	case "~":
+		if mode == 4 {
+			visual_operator(name, count)
+		} else {
+			toggle_case_chars(count)
+		}
+	case "<C-a>":
+		increment_number(max(count, 1))
+	case "<C-x>":
+		increment_number(-max(count, 1))
+	case "r":
+		if mode == 4 {
+			replace_selection()
 		}
+	case "I", "A":
+		if mode == 4 && visualKind == "<C-v>" {
+			visual_operator(name, count)
+		}
+	case ".":
+		repeat_change(count)
+	case "u":
+		if mode == 4 {
+			visual_operator(name, count)
+			break
+		}
+		for i := 0; i < max(count, 1) && len(undoStack) > 0; i++ {
+			pull_buffer()
+		}
+	case "/":
+		findText()
+	case ":":
+		// In VISUAL mode the command acts on the selected lines
+		if mode == 4 {
+			end_visual()
+			command_line("'<,'>")
+		} else {
+			command_line("")
+		}
+	case "o":
+		if mode == 4 {
+			swap_selection_ends()
+			break
+		}
+		currentCol = len(text_buffer[currentRow])
+		insert_line()
+		modified = 0
+		mode = 1
+	case "O":
+		open_line_above()
+	case "<C-s>":
+		write_file(source_file)
+	case "<C-g>":
+		jumpToLine(nil)
+	}
+}
+
+// update_size reads the terminal size into COLS and ROWS, keeping the last
+// row for the status bar, and sizes the line number gutter to fit.
+func update_size() {
+	COLS, ROWS = termbox.Size()
+	ROWS = max(ROWS-1, 0)
+	lineNumberWidth = max(len(strconv.Itoa(len(text_buffer))), 4) + 1
+	// Give up the gutter rather than the text on very narrow terminals
+	if COLS < lineNumberWidth+8 {
+		lineNumberWidth = 0
 	}
 }
 
@@ -1234,6 +1431,7 @@ func run_editor() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	enable_bracketed_paste()
 
 	if len(os.Args) > 1 {
 		source_file = os.Args[1]
@@ -1243,26 +1441,42 @@ func run_editor() {
 		text_buffer = append(text_buffer, []rune{})
 	}
 
+	load_config()
+	load_info()
 	modified = 1
 	source_file2 = source_file
 	source_file2 = strings.Replace(source_file, ".", "", 1)
 	source_file2 = strings.ReplaceAll(source_file, "/", "")
 	for {
-		COLS, ROWS = termbox.Size()
-		ROWS--
-		if COLS < 78 {
-			COLS = 78
-		}
-		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
-		scroll_text_buffer()
-		display_text_buffer()
-		display_status_bar()
-		termbox.SetCursor(currentCol-offsetCol+lineNumberWidth, currentRow-offsetRow)
-		termbox.Flush()
+		redraw()
 		process_key_press()
 	}
 }
 
+// redraw draws the text, the status bar and the cursor.
+func redraw() {
+	// Commands replayed before termbox starts, as in tests, have no screen
+	if !termbox.IsInit {
+		return
+	}
+	update_input_mode()
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	update_size()
+	scroll_text_buffer()
+	display_text_buffer()
+	if statusMessage != "" {
+		print_message(0, ROWS, termbox.ColorWhite, termbox.ColorDefault, " "+statusMessage)
+	} else {
+		display_status_bar()
+	}
+	if ROWS > 0 {
+		termbox.SetCursor(cursor_screen_position())
+	} else {
+		termbox.HideCursor()
+	}
+	termbox.Flush()
+}
+
 func main() {
 	run_editor()
 }
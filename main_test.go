@@ -0,0 +1,189 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// set_buffer replaces the buffer with lines and puts the cursor at the start
+// of the first one.
+func set_buffer(lines ...string) {
+	text_buffer = make([][]rune, len(lines))
+	for i, line := range lines {
+		text_buffer[i] = []rune(line)
+	}
+	currentRow, currentCol, preferredCol = 0, 0, 0
+	undoStack = nil
+	mode = 0
+	marks = map[rune]position{}
+	jumpList, jumpIndex = nil, 0
+	forget_bracket_matches()
+}
+
+// buffer_lines returns the buffer as strings.
+func buffer_lines() []string {
+	lines := make([]string, len(text_buffer))
+	for i, line := range text_buffer {
+		lines[i] = string(line)
+	}
+	return lines
+}
+
+// key_events turns keys into key events, where control characters such as
+// "\x1b" for Esc and "\x10" for Ctrl+P are the termbox keys with that code.
+func key_events(keys string) []input_event {
+	events := []input_event{}
+	for _, ch := range keys {
+		event := termbox.Event{Type: termbox.EventKey, Ch: ch}
+		if ch < ' ' || ch == '\x7f' {
+			event = termbox.Event{Type: termbox.EventKey, Key: termbox.Key(ch)}
+		}
+		events = append(events, input_event{Event: event})
+	}
+	return events
+}
+
+// run_keys handles keys as if they were typed, failing the test instead of
+// waiting for the terminal if a command is left wanting more.
+func run_keys(t *testing.T, keys string) {
+	t.Helper()
+	pendingInput = append(pendingInput, key_events(keys)...)
+	done := make(chan bool)
+	go func() {
+		for len(pendingInput) > 0 {
+			process_key_press()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("keys %q left a command waiting for input", keys)
+	}
+}
+
+// keep_options restores the options when the test ends.
+func keep_options(t *testing.T) {
+	saved := options
+	t.Cleanup(func() { options = saved })
+}
+
+func TestVisualCol(t *testing.T) {
+	keep_options(t)
+	options.tabWidth = 4
+	tests := []struct {
+		line string
+		col  int
+		want int
+	}{
+		{"abc", 2, 2},
+		{"\tx", 1, 4},
+		{"a\tx", 2, 4},
+		{"abcd\tx", 5, 8},
+		{"\t\tx", 2, 8},
+		{"ab", 5, 2},
+	}
+	for _, test := range tests {
+		if got := visual_col([]rune(test.line), test.col); got != test.want {
+			t.Errorf("visual_col(%q, %d) = %d, want %d", test.line, test.col, got, test.want)
+		}
+	}
+}
+
+func TestColFromVisual(t *testing.T) {
+	keep_options(t)
+	options.tabWidth = 4
+	tests := []struct {
+		line string
+		vcol int
+		want int
+	}{
+		{"abc", 1, 1},
+		{"\tx", 0, 0},
+		{"\tx", 3, 0},
+		{"\tx", 4, 1},
+		{"a\tx", 2, 1},
+		{"ab", 9, 2},
+	}
+	for _, test := range tests {
+		if got := col_from_visual([]rune(test.line), test.vcol); got != test.want {
+			t.Errorf("col_from_visual(%q, %d) = %d, want %d", test.line, test.vcol, got, test.want)
+		}
+	}
+}
+
+func TestInsertTab(t *testing.T) {
+	keep_options(t)
+	tab := termbox.Event{Type: termbox.EventKey, Key: termbox.KeyTab}
+	tests := []struct {
+		line      string
+		col       int
+		expandTab bool
+		want      string
+	}{
+		{"", 0, true, "    "},
+		{"ab", 2, true, "ab  "},
+		{"abcd", 4, true, "abcd    "},
+		{"", 0, false, "\t"},
+		{"ab", 1, false, "a\tb"},
+	}
+	for _, test := range tests {
+		options.tabWidth, options.expandTab = 4, test.expandTab
+		set_buffer(test.line)
+		currentCol = test.col
+		insert_rune(tab)
+		if got := string(text_buffer[0]); got != test.want {
+			t.Errorf("Tab in %q at %d = %q, want %q", test.line, test.col, got, test.want)
+		}
+	}
+}
+
+func TestBackspaceSoftTabStop(t *testing.T) {
+	keep_options(t)
+	tests := []struct {
+		line        string
+		col         int
+		softTabStop int
+		want        string
+	}{
+		{"        x", 8, -1, "    x"},
+		{"      x", 6, -1, "    x"},
+		{"    x", 4, 0, "   x"},
+		{"\t\tx", 2, -1, "\tx"},
+		{"ab  x", 4, -1, "ab x"},
+		{"        x", 8, 2, "      x"},
+	}
+	for _, test := range tests {
+		options.tabWidth, options.softTabStop = 4, test.softTabStop
+		set_buffer(test.line)
+		currentCol = test.col
+		delete_rune()
+		if got := string(text_buffer[0]); got != test.want {
+			t.Errorf("Backspace in %q at %d = %q, want %q", test.line, test.col, got, test.want)
+		}
+	}
+}
+
+func TestSetOption(t *testing.T) {
+	keep_options(t)
+	for _, arg := range []string{"ts=8", "noet", "sts=2"} {
+		if err := set_option(arg); err != nil {
+			t.Fatalf("set %s: %v", arg, err)
+		}
+	}
+	want := []int{8, 2}
+	if got := []int{options.tabWidth, options.softTabStop}; !reflect.DeepEqual(got, want) || options.expandTab {
+		t.Errorf("options = %+v", options)
+	}
+	if err := set_option("tabwidth?"); err != nil || statusMessage != "tabwidth=8" {
+		t.Errorf("set tabwidth? = %q, %v", statusMessage, err)
+	}
+	for _, arg := range []string{"ts=0", "ts=x", "ts", "et=1", "nots=4", "bogus"} {
+		if err := set_option(arg); err == nil {
+			t.Errorf("set %s: no error", arg)
+		}
+	}
+}
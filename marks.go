@@ -0,0 +1,251 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// file_mark is a global mark, which remembers the file it was set in.
+type file_mark struct {
+	file string
+	position
+}
+
+const jumpListSize = 100
+
+var (
+	// marks are the a-z marks of the open file and globalMarks the A-Z ones
+	// of any file.
+	marks       = map[rune]position{}
+	globalMarks = map[rune]file_mark{}
+	// jumpList holds where the cursor was before each jump, oldest first.
+	// jumpIndex is the entry Ctrl+O and Ctrl+I last went to, or
+	// len(jumpList) when they haven't been used since the last jump.
+	jumpList  []position
+	jumpIndex int
+	// operatorPending is set while an operator reads its motion, when a mark
+	// in another file can't be jumped to.
+	operatorPending bool
+)
+
+// current_file_path is the absolute path marks of the open file are saved
+// under.
+func current_file_path() string {
+	path, err := filepath.Abs(source_file)
+	if err != nil {
+		return source_file
+	}
+	return path
+}
+
+// set_mark reads a mark name after m and puts that mark on the cursor.
+func set_mark() {
+	name := key_char(get_pending_key())
+	switch {
+	case name >= 'a' && name <= 'z':
+		marks[name] = cursor()
+	case name >= 'A' && name <= 'Z':
+		globalMarks[name] = file_mark{current_file_path(), cursor()}
+	}
+}
+
+// motion_mark implements ' and `, which go to the line or the exact
+// position of a mark. Followed by ' or ` instead of a mark name they go
+// back to where the cursor was before the latest jump.
+func motion_mark(exact bool) (motion, bool) {
+	name := key_char(get_pending_key())
+	var target position
+	switch {
+	case name >= 'a' && name <= 'z':
+		p, found := marks[name]
+		if !found {
+			statusMessage = "Mark not set"
+			return motion{}, false
+		}
+		target = p
+	case name >= 'A' && name <= 'Z':
+		mark, found := globalMarks[name]
+		if !found {
+			statusMessage = "Mark not set"
+			return motion{}, false
+		}
+		if mark.file != current_file_path() && !open_mark_file(mark.file) {
+			return motion{}, false
+		}
+		target = mark.position
+	case name == '\'' || name == '`':
+		if len(jumpList) == 0 {
+			return motion{}, false
+		}
+		target = jumpList[len(jumpList)-1]
+	default:
+		return motion{}, false
+	}
+
+	target.row = max(min(target.row, len(text_buffer)-1), 0)
+	target.col = min(target.col, len(text_buffer[target.row]))
+	if !exact {
+		return motion{position: position{target.row, first_non_blank(target.row)}, linewise: true, jump: true}, true
+	}
+	return motion{position: target, jump: true}, true
+}
+
+// open_mark_file switches to the file a global mark is in, which needs the
+// open file to be saved first.
+func open_mark_file(path string) bool {
+	if operatorPending {
+		return false
+	}
+	if modified == 0 {
+		statusMessage = "No write since last change"
+		return false
+	}
+	if _, err := os.Stat(path); err != nil {
+		statusMessage = err.Error()
+		return false
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		if relative, err := filepath.Rel(cwd, path); err == nil {
+			path = relative
+		}
+	}
+	open_file(path)
+	return true
+}
+
+// record_jump adds the cursor position to the jump list before a jump,
+// replacing any older entry for the same line.
+func record_jump() {
+	p := cursor()
+	kept := jumpList[:0]
+	for _, entry := range jumpList {
+		if entry.row != p.row {
+			kept = append(kept, entry)
+		}
+	}
+	jumpList = append(kept, p)
+	if len(jumpList) > jumpListSize {
+		jumpList = jumpList[len(jumpList)-jumpListSize:]
+	}
+	jumpIndex = len(jumpList)
+}
+
+// jump_older goes count entries back through the jump list for Ctrl+O and
+// jump_newer forward again for Ctrl+I.
+func jump_older(count int) {
+	if jumpIndex == len(jumpList) {
+		// Remember where we are so Ctrl+I can come back here
+		record_jump()
+		jumpIndex = len(jumpList) - 1
+	}
+	go_to_jump(jumpIndex - max(count, 1))
+}
+
+func jump_newer(count int) {
+	go_to_jump(jumpIndex + max(count, 1))
+}
+
+func go_to_jump(index int) {
+	if index < 0 || index >= len(jumpList) {
+		abort_pending_input()
+		return
+	}
+	jumpIndex = index
+	p := jumpList[index]
+	row := max(min(p.row, len(text_buffer)-1), 0)
+	move_to(motion{position: position{row, min(p.col, len(text_buffer[row]))}})
+}
+
+// move_marks moves every mark and jump list entry of the open file with
+// move, which reports false for marks on text that no longer exists. Jump
+// list entries are kept at the position move falls back to.
+func move_marks(move func(p position) (position, bool)) {
+	for name, p := range marks {
+		if moved, ok := move(p); ok {
+			marks[name] = moved
+		} else {
+			delete(marks, name)
+		}
+	}
+	path := current_file_path()
+	for name, mark := range globalMarks {
+		if mark.file != path {
+			continue
+		}
+		if moved, ok := move(mark.position); ok {
+			mark.position = moved
+			globalMarks[name] = mark
+		} else {
+			delete(globalMarks, name)
+		}
+	}
+	for i, p := range jumpList {
+		jumpList[i], _ = move(p)
+	}
+}
+
+// marks_lines_inserted shifts marks down past count lines inserted at row.
+func marks_lines_inserted(row, count int) {
+	move_marks(func(p position) (position, bool) {
+		if p.row >= row {
+			p.row += count
+		}
+		return p, true
+	})
+}
+
+// marks_lines_deleted drops marks on the deleted rows first to last and
+// shifts the ones below up.
+func marks_lines_deleted(first, last int) {
+	move_marks(func(p position) (position, bool) {
+		switch {
+		case p.row > last:
+			p.row -= last - first + 1
+		case p.row >= first:
+			return position{first, 0}, false
+		}
+		return p, true
+	})
+}
+
+// marks_lines_moved follows rows first to last being moved delta rows down,
+// or up when delta is negative, past the rows in between.
+func marks_lines_moved(first, last, delta int) {
+	count := last - first + 1
+	move_marks(func(p position) (position, bool) {
+		switch {
+		case p.row >= first && p.row <= last:
+			p.row += delta
+		case delta > 0 && p.row > last && p.row <= last+delta:
+			p.row -= count
+		case delta < 0 && p.row >= first+delta && p.row < first:
+			p.row += count
+		}
+		return p, true
+	})
+}
+
+// marks_line_split follows row being split in two at col.
+func marks_line_split(row, col int) {
+	move_marks(func(p position) (position, bool) {
+		if p.row > row {
+			p.row++
+		} else if p.row == row && p.col >= col {
+			p = position{row + 1, p.col - col}
+		}
+		return p, true
+	})
+}
+
+// marks_line_joined follows row+1 being joined onto the end of row, which
+// was col long.
+func marks_line_joined(row, col int) {
+	move_marks(func(p position) (position, bool) {
+		if p.row > row+1 {
+			p.row--
+		} else if p.row == row+1 {
+			p = position{row, p.col + col}
+		}
+		return p, true
+	})
+}
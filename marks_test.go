@@ -0,0 +1,85 @@
+package main
+
+import "testing"
+
+func TestMarks(t *testing.T) {
+	tests := []struct {
+		lines []string
+		keys  string
+		want  position
+	}{
+		{[]string{"one", "  two", "three"}, "jllmaG'a", position{1, 2}},
+		{[]string{"one", "  two", "three"}, "jlllmaG`a", position{1, 3}},
+		{[]string{"one", "two", "three"}, "jlmaggdd`a", position{0, 1}},
+		{[]string{"one", "two", "three"}, "jlmaggo\x1b`a", position{2, 1}},
+		{[]string{"one", "two", "three"}, "jlmajdd`a", position{1, 1}},
+		{[]string{"one", "two", "three"}, "G''", position{0, 0}},
+		{[]string{"one", "two", "three"}, "G''''", position{2, 0}},
+		{[]string{"one", "two", "three"}, "G`b", position{2, 0}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		run_keys(t, test.keys)
+		if got := cursor(); got != test.want {
+			t.Errorf("%q on %q put the cursor on %v, want %v", test.keys, test.lines, got, test.want)
+		}
+	}
+}
+
+func TestMarkDeletedLine(t *testing.T) {
+	set_buffer("one", "two", "three")
+	run_keys(t, "jmadd")
+	if _, found := marks['a']; found {
+		t.Errorf("mark on a deleted line survived at %v", marks['a'])
+	}
+}
+
+func TestJumpList(t *testing.T) {
+	set_buffer("1", "2", "3", "4", "5")
+	run_keys(t, "3GG")
+	tests := []struct {
+		keys string
+		row  int
+	}{
+		{"\x0f", 2},
+		{"\x0f", 0},
+		{"\x0f", 0},
+		{"\t", 2},
+		{"\t", 4},
+		{"2\x0f", 0},
+	}
+	for _, test := range tests {
+		run_keys(t, test.keys)
+		if currentRow != test.row {
+			t.Errorf("%q went to row %d, want %d", test.keys, currentRow, test.row)
+		}
+	}
+}
+
+func TestSaveMarks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	savedFile := source_file
+	t.Cleanup(func() { source_file = savedFile })
+	source_file = "one.txt"
+	set_buffer("one", "two")
+	marks['a'] = position{1, 2}
+	globalMarks = map[rune]file_mark{'B': {"/elsewhere/two.txt", position{3, 4}}}
+	if err := save_info(); err != nil {
+		t.Fatal(err)
+	}
+
+	marks, globalMarks = map[rune]position{}, map[rune]file_mark{}
+	source_file = "two.txt"
+	load_info()
+	if len(marks) != 0 {
+		t.Errorf("marks of one.txt loaded for two.txt: %v", marks)
+	}
+	if got := globalMarks['B']; got.file != "/elsewhere/two.txt" || got.position != (position{3, 4}) {
+		t.Errorf("global mark B = %v", got)
+	}
+	source_file = "one.txt"
+	load_info()
+	if got := marks['a']; got != (position{1, 2}) {
+		t.Errorf("mark a = %v", got)
+	}
+}
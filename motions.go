@@ -0,0 +1,478 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+type position struct{ row, col int }
+
+// motion is where a cursor motion lands, plus how an operator should treat
+// the text between the cursor and that position.
+type motion struct {
+	position
+	linewise  bool // Operators act on whole lines (j, k, G, ...)
+	inclusive bool // The character at the target is part of the range (e, $, f, ...)
+	vertical  bool // The motion keeps preferredCol instead of resetting it
+	jump      bool // A large jump that may scroll the target into the middle of the screen
+}
+
+// motionTable maps key names (see key_name) to motions. Each takes a count,
+// which is 0 when none was typed, and reports false if it can't move.
+var motionTable = map[string]func(count int) (motion, bool){
+	"h":          motion_left,
+	"<Left>":     motion_left,
+	"<BS>":       motion_left,
+	"l":          motion_right,
+	"<Right>":    motion_right,
+	"<Del>":      motion_right,
+	" ":          motion_right,
+	"j":          func(count int) (motion, bool) { return motion_rows(max(count, 1)) },
+	"<Down>":     func(count int) (motion, bool) { return motion_rows(max(count, 1)) },
+	"<CR>":       func(count int) (motion, bool) { return motion_rows(max(count, 1)) },
+	"k":          func(count int) (motion, bool) { return motion_rows(-max(count, 1)) },
+	"<Up>":       func(count int) (motion, bool) { return motion_rows(-max(count, 1)) },
+	"gj":         func(count int) (motion, bool) { return motion_display_rows(max(count, 1)) },
+	"gk":         func(count int) (motion, bool) { return motion_display_rows(-max(count, 1)) },
+	"<PageDown>": func(count int) (motion, bool) { return motion_rows(max(count, 1) * max(ROWS/4, 1)) },
+	"<PageUp>":   func(count int) (motion, bool) { return motion_rows(-max(count, 1) * max(ROWS/4, 1)) },
+	"0":          motion_line_start,
+	"<Home>":     motion_line_start,
+	"^":          motion_first_non_blank,
+	"$":          motion_line_end,
+	"<End>":      motion_line_end,
+	"w":          func(count int) (motion, bool) { return motion_word_forward(count, false) },
+	"W":          func(count int) (motion, bool) { return motion_word_forward(count, true) },
+	"b":          func(count int) (motion, bool) { return motion_word_backward(count, false) },
+	"B":          func(count int) (motion, bool) { return motion_word_backward(count, true) },
+	"e":          func(count int) (motion, bool) { return motion_word_end(count, false) },
+	"E":          func(count int) (motion, bool) { return motion_word_end(count, true) },
+	"}":          func(count int) (motion, bool) { return motion_paragraph(count, 1) },
+	"{":          func(count int) (motion, bool) { return motion_paragraph(count, -1) },
+	"f":          func(count int) (motion, bool) { return motion_find_char('f', count) },
+	"F":          func(count int) (motion, bool) { return motion_find_char('F', count) },
+	"t":          func(count int) (motion, bool) { return motion_find_char('t', count) },
+	"T":          func(count int) (motion, bool) { return motion_find_char('T', count) },
+	";":          func(count int) (motion, bool) { return motion_repeat_find(count, false) },
+	",":          func(count int) (motion, bool) { return motion_repeat_find(count, true) },
+	"%":          motion_match_bracket,
+	"'":          func(count int) (motion, bool) { return motion_mark(false) },
+	"`":          func(count int) (motion, bool) { return motion_mark(true) },
+	"H":          func(count int) (motion, bool) { return motion_screen('H', count) },
+	"M":          func(count int) (motion, bool) { return motion_screen('M', count) },
+	"L":          func(count int) (motion, bool) { return motion_screen('L', count) },
+	"gg":         func(count int) (motion, bool) { return motion_goto_line(max(count, 1)) },
+	"G": func(count int) (motion, bool) {
+		if count == 0 {
+			count = len(text_buffer)
+		}
+		return motion_goto_line(count)
+	},
+}
+
+// insertModeMotions are the motions that also work in INSERT mode.
+var insertModeMotions = map[string]bool{
+	"<Up>": true, "<Down>": true, "<Left>": true, "<Right>": true,
+	"<Home>": true, "<End>": true, "<PageUp>": true, "<PageDown>": true,
+}
+
+// lastFind remembers the last f/F/t/T so ; and , can repeat it.
+var lastFind struct {
+	command rune
+	char    rune
+}
+
+// run_motion moves the cursor with the motion named name, extending the
+// selection in VISUAL mode. It reports whether name is a motion at all.
+func run_motion(name string, count int) bool {
+	motionFunc, found := motionTable[name]
+	if !found {
+		return false
+	}
+	target, ok := motionFunc(count)
+	if !ok {
+		abort_pending_input()
+		return true
+	}
+	move_to(target)
+	return true
+}
+
+// move_to puts the cursor on a motion's target, scrolling a far jump to the
+// middle of the screen the way jumpToLine does.
+func move_to(target motion) {
+	if target.jump {
+		record_jump()
+	}
+	if target.jump && (target.row < offsetRow || target.row >= offsetRow+ROWS) {
+		lineNumber := target.row + 1
+		jumpToLine(&lineNumber)
+	}
+	currentRow, currentCol = target.row, target.col
+	if target.vertical {
+		keepPreferredCol = true
+	}
+	if mode == 4 {
+		selectionEnd.row, selectionEnd.col = currentRow, currentCol
+	}
+}
+
+func cursor() position {
+	return position{currentRow, currentCol}
+}
+
+// char_at returns the character at p, or '\n' for the position just past the
+// end of a line.
+func char_at(p position) rune {
+	line := text_buffer[p.row]
+	if p.col >= len(line) {
+		return '\n'
+	}
+	return line[p.col]
+}
+
+// next_position steps one character forward, visiting the end of each line
+// before moving to the next one. It reports false at the end of the buffer.
+func next_position(p position) (position, bool) {
+	line := text_buffer[p.row]
+	if p.col < len(line) {
+		return position{p.row, grapheme_end(line, p.col)}, true
+	}
+	if p.row+1 < len(text_buffer) {
+		return position{p.row + 1, 0}, true
+	}
+	return p, false
+}
+
+// prev_position is the reverse of next_position.
+func prev_position(p position) (position, bool) {
+	if p.col > 0 {
+		return position{p.row, prev_grapheme(text_buffer[p.row], p.col)}, true
+	}
+	if p.row > 0 {
+		return position{p.row - 1, len(text_buffer[p.row-1])}, true
+	}
+	return p, false
+}
+
+func is_word_char(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(options.wordChars, r)
+}
+
+// word_class groups characters for word motions: 0 for blanks and line
+// ends, 1 for punctuation and 2 for word characters. For WORD motions
+// (bigWord) every non-blank is class 1.
+func word_class(r rune, bigWord bool) int {
+	switch {
+	case r == ' ' || r == '\t' || r == '\n':
+		return 0
+	case bigWord:
+		return 1
+	case is_word_char(r):
+		return 2
+	}
+	return 1
+}
+
+func is_empty_line(p position) bool {
+	return len(text_buffer[p.row]) == 0
+}
+
+func first_non_blank(row int) int {
+	line := text_buffer[row]
+	col := 0
+	for col < len(line) && (line[col] == ' ' || line[col] == '\t') {
+		col++
+	}
+	return col
+}
+
+func motion_left(count int) (motion, bool) {
+	p := cursor()
+	for i := 0; i < max(count, 1); i++ {
+		if p.col != 0 {
+			p.col = prev_grapheme(text_buffer[p.row], p.col)
+		} else if p.row > 0 {
+			p.row--
+			p.col = len(text_buffer[p.row])
+		} else {
+			return motion{position: p}, i > 0
+		}
+	}
+	return motion{position: p}, true
+}
+
+func motion_right(count int) (motion, bool) {
+	p := cursor()
+	for i := 0; i < max(count, 1); i++ {
+		if p.col != len(text_buffer[p.row]) {
+			p.col = grapheme_end(text_buffer[p.row], p.col)
+		} else if p.row < len(text_buffer)-1 {
+			p.row++
+			p.col = 0
+		} else {
+			return motion{position: p}, i > 0
+		}
+	}
+	return motion{position: p}, true
+}
+
+// motion_rows moves delta lines, keeping preferredCol.
+func motion_rows(delta int) (motion, bool) {
+	row := max(min(currentRow+delta, len(text_buffer)-1), 0)
+	if row == currentRow {
+		return motion{}, false
+	}
+	col := col_from_visual(text_buffer[row], preferredCol)
+	return motion{position: position{row, col}, linewise: true, vertical: true}, true
+}
+
+func motion_display_rows(delta int) (motion, bool) {
+	row, col := display_rows_target(delta)
+	if row == currentRow && col == currentCol {
+		return motion{}, false
+	}
+	return motion{position: position{row, col}, linewise: !options.wrap, vertical: !options.wrap}, true
+}
+
+func motion_line_start(count int) (motion, bool) {
+	return motion{position: position{currentRow, 0}}, true
+}
+
+func motion_first_non_blank(count int) (motion, bool) {
+	return motion{position: position{currentRow, first_non_blank(currentRow)}}, true
+}
+
+// motion_line_end goes to the end of the line, or of the line count-1 lines
+// further down.
+func motion_line_end(count int) (motion, bool) {
+	row := min(currentRow+max(count, 1)-1, len(text_buffer)-1)
+	return motion{position: position{row, len(text_buffer[row])}}, true
+}
+
+// motion_word_forward implements w/W: the start of the next word, where an
+// empty line also counts as a word.
+func motion_word_forward(count int, bigWord bool) (motion, bool) {
+	p := cursor()
+	for i := 0; i < max(count, 1); i++ {
+		start := p
+		class := word_class(char_at(p), bigWord)
+		ok := true
+		if class != 0 {
+			for ok && char_at(p) != '\n' && word_class(char_at(p), bigWord) == class {
+				p, ok = next_position(p)
+			}
+		}
+		for ok && word_class(char_at(p), bigWord) == 0 {
+			if is_empty_line(p) && p != start {
+				break
+			}
+			p, ok = next_position(p)
+		}
+		if !ok && p == start {
+			return motion{position: p}, i > 0
+		}
+	}
+	return motion{position: p}, true
+}
+
+// motion_word_end implements e/E: the last character of the current or
+// next word.
+func motion_word_end(count int, bigWord bool) (motion, bool) {
+	p := cursor()
+	for i := 0; i < max(count, 1); i++ {
+		next, ok := next_position(p)
+		if !ok {
+			return motion{position: p, inclusive: true}, i > 0
+		}
+		p = next
+		for ok && word_class(char_at(p), bigWord) == 0 {
+			next, ok = next_position(p)
+			if ok {
+				p = next
+			}
+		}
+		class := word_class(char_at(p), bigWord)
+		for {
+			next, ok := next_position(p)
+			if !ok || char_at(next) == '\n' || word_class(char_at(next), bigWord) != class {
+				break
+			}
+			p = next
+		}
+	}
+	return motion{position: p, inclusive: true}, true
+}
+
+// motion_word_backward implements b/B: the start of the current or previous
+// word.
+func motion_word_backward(count int, bigWord bool) (motion, bool) {
+	p := cursor()
+	for i := 0; i < max(count, 1); i++ {
+		prev, ok := prev_position(p)
+		if !ok {
+			return motion{position: p}, i > 0
+		}
+		p = prev
+		for word_class(char_at(p), bigWord) == 0 && !is_empty_line(p) {
+			prev, ok = prev_position(p)
+			if !ok {
+				break
+			}
+			p = prev
+		}
+		class := word_class(char_at(p), bigWord)
+		for class != 0 {
+			prev, ok := prev_position(p)
+			if !ok || prev.row != p.row || word_class(char_at(prev), bigWord) != class {
+				break
+			}
+			p = prev
+		}
+	}
+	return motion{position: p}, true
+}
+
+// motion_paragraph implements { and }: the next empty line before or after
+// the current paragraph, or the start or end of the buffer.
+func motion_paragraph(count int, direction int) (motion, bool) {
+	row := currentRow
+	last := len(text_buffer) - 1
+	for i := 0; i < max(count, 1); i++ {
+		for row >= 0 && row <= last && len(text_buffer[row]) == 0 {
+			row += direction
+		}
+		for row >= 0 && row <= last && len(text_buffer[row]) != 0 {
+			row += direction
+		}
+	}
+	target := position{row, 0}
+	if row < 0 {
+		target = position{0, 0}
+	} else if row > last {
+		target = position{last, len(text_buffer[last])}
+	}
+	if target == cursor() {
+		return motion{}, false
+	}
+	return motion{position: target, jump: true}, true
+}
+
+// motion_find_char reads a character and finds its count-th occurrence on
+// the current line: f/t search forward and F/T backward, with t/T stopping
+// one character short.
+func motion_find_char(command rune, count int) (motion, bool) {
+	ch := key_char(get_pending_key())
+	if ch == 0 {
+		return motion{}, false
+	}
+	lastFind.command, lastFind.char = command, ch
+	return find_char(command, ch, count, false)
+}
+
+// motion_repeat_find implements ; and , which repeat the last f/F/t/T in the
+// same or the opposite direction.
+func motion_repeat_find(count int, reverse bool) (motion, bool) {
+	if lastFind.command == 0 {
+		return motion{}, false
+	}
+	command := lastFind.command
+	if reverse {
+		command = map[rune]rune{'f': 'F', 'F': 'f', 't': 'T', 'T': 't'}[command]
+	}
+	return find_char(command, lastFind.char, count, true)
+}
+
+func find_char(command rune, ch rune, count int, repeat bool) (motion, bool) {
+	line := text_buffer[currentRow]
+	forward := command == 'f' || command == 't'
+	col := currentCol
+	// Repeating t/T would otherwise find the character right next to the
+	// cursor again and never move
+	if repeat && command == 't' {
+		col++
+	} else if repeat && command == 'T' {
+		col--
+	}
+	for i := 0; i < max(count, 1); i++ {
+		found := false
+		if forward {
+			for col++; col < len(line); col++ {
+				if line[col] == ch {
+					found = true
+					break
+				}
+			}
+		} else {
+			for col--; col >= 0; col-- {
+				if line[col] == ch {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return motion{}, false
+		}
+	}
+	switch command {
+	case 't':
+		col--
+	case 'T':
+		col++
+	}
+	return motion{position: position{currentRow, col}, inclusive: forward}, true
+}
+
+func motion_match_bracket(count int) (motion, bool) {
+	target, ok := match_bracket(cursor())
+	if !ok {
+		return motion{}, false
+	}
+	return motion{position: target, inclusive: true, jump: true}, true
+}
+
+// match_bracket finds the first bracket at or after p on its line and
+// returns the position of its partner, searching across lines and skipping
+// nested pairs and brackets in strings and comments.
+func match_bracket(p position) (position, bool) {
+	pairs := matching_brackets()
+	for ; p.col < len(text_buffer[p.row]); p.col++ {
+		if partner, found := pairs[p]; found {
+			return partner, partner != p
+		}
+	}
+	return p, false
+}
+
+// motion_screen implements H, M and L: the top, middle or bottom line on
+// screen, with a count counting lines in from the top or bottom.
+func motion_screen(command rune, count int) (motion, bool) {
+	top, bottom := -1, -1
+	for _, screenLine := range layout_screen() {
+		if screenLine.row < len(text_buffer) && !screenLine.continuation {
+			if top < 0 {
+				top = screenLine.row
+			}
+			bottom = screenLine.row
+		}
+	}
+	if top < 0 {
+		return motion{}, false
+	}
+	row := (top + bottom) / 2
+	switch command {
+	case 'H':
+		row = min(top+max(count, 1)-1, bottom)
+	case 'L':
+		row = max(bottom-max(count, 1)+1, top)
+	}
+	return motion{position: position{row, first_non_blank(row)}, linewise: true, jump: true}, true
+}
+
+// motion_goto_line goes to the first non-blank of line lineNumber (counting
+// from 1), clamped to the buffer.
+func motion_goto_line(lineNumber int) (motion, bool) {
+	row := max(min(lineNumber, len(text_buffer)), 1) - 1
+	return motion{position: position{row, first_non_blank(row)}, linewise: true, jump: true}, true
+}
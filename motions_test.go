@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestMotions(t *testing.T) {
+	lines := []string{
+		"foo.bar baz",
+		"  indented line",
+		"",
+		"last (a [b] c)",
+	}
+	tests := []struct {
+		name     string
+		count    int
+		from     position
+		want     position
+		linewise bool
+	}{
+		{"l", 0, position{0, 0}, position{0, 1}, false},
+		{"l", 20, position{0, 0}, position{1, 8}, false},
+		{"h", 2, position{0, 5}, position{0, 3}, false},
+		{"j", 0, position{0, 4}, position{1, 4}, true},
+		{"k", 5, position{3, 0}, position{0, 0}, true},
+		{"0", 0, position{1, 5}, position{1, 0}, false},
+		{"^", 0, position{1, 5}, position{1, 2}, false},
+		{"$", 0, position{0, 0}, position{0, 11}, false},
+		{"$", 2, position{0, 0}, position{1, 15}, false},
+		{"w", 0, position{0, 0}, position{0, 3}, false},
+		{"w", 3, position{0, 0}, position{0, 8}, false},
+		{"W", 0, position{0, 0}, position{0, 8}, false},
+		{"w", 0, position{0, 8}, position{1, 2}, false},
+		{"w", 0, position{1, 11}, position{2, 0}, false},
+		{"e", 0, position{0, 0}, position{0, 2}, false},
+		{"E", 0, position{0, 0}, position{0, 6}, false},
+		{"b", 0, position{0, 8}, position{0, 4}, false},
+		{"B", 0, position{0, 8}, position{0, 0}, false},
+		{"b", 0, position{1, 2}, position{0, 8}, false},
+		{"}", 0, position{0, 3}, position{2, 0}, false},
+		{"{", 0, position{3, 3}, position{2, 0}, false},
+		{"%", 0, position{3, 0}, position{3, 13}, false},
+		{"%", 0, position{3, 10}, position{3, 8}, false},
+		{"G", 0, position{0, 0}, position{3, 0}, true},
+		{"G", 2, position{0, 0}, position{1, 2}, true},
+		{"gg", 0, position{3, 0}, position{0, 0}, true},
+	}
+	for _, test := range tests {
+		set_buffer(lines...)
+		currentRow, currentCol = test.from.row, test.from.col
+		preferredCol = test.from.col
+		target, ok := motionTable[test.name](test.count)
+		if !ok || target.position != test.want || target.linewise != test.linewise {
+			t.Errorf("%d%s from %v = %v linewise %v (%v), want %v linewise %v", test.count, test.name, test.from, target.position, target.linewise, ok, test.want, test.linewise)
+		}
+	}
+}
+
+func TestFindChar(t *testing.T) {
+	set_buffer("a,b,c,d")
+	tests := []struct {
+		command rune
+		count   int
+		col     int
+		repeat  bool
+		want    int
+		ok      bool
+	}{
+		{'f', 0, 0, false, 1, true},
+		{'f', 2, 0, false, 3, true},
+		{'t', 0, 0, false, 0, true},
+		{'t', 0, 0, true, 2, true},
+		{'F', 0, 6, false, 5, true},
+		{'T', 0, 6, false, 6, true},
+		{'T', 0, 6, true, 4, true},
+		{'f', 4, 0, false, 0, false},
+	}
+	for _, test := range tests {
+		currentCol = test.col
+		target, ok := find_char(test.command, ',', test.count, test.repeat)
+		if ok != test.ok || ok && target.col != test.want {
+			t.Errorf("%d%c, from %d (repeat %v) = %d (%v), want %d (%v)", test.count, test.command, test.col, test.repeat, target.col, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestKeyName(t *testing.T) {
+	tests := []struct {
+		event termbox.Event
+		want  string
+	}{
+		{termbox.Event{Type: termbox.EventKey, Ch: 'x'}, "x"},
+		{termbox.Event{Type: termbox.EventKey, Key: termbox.KeyEnter}, "<CR>"},
+		{termbox.Event{Type: termbox.EventKey, Key: termbox.KeySpace}, " "},
+		{termbox.Event{Type: termbox.EventKey, Key: termbox.KeyCtrlR}, "<C-r>"},
+		{termbox.Event{Type: termbox.EventMouse, Key: termbox.MouseLeft}, ""},
+	}
+	for _, test := range tests {
+		if got := key_name(input_event{Event: test.event}); got != test.want {
+			t.Errorf("key_name(%+v) = %q, want %q", test.event, got, test.want)
+		}
+	}
+}
+
+func TestCountedMotions(t *testing.T) {
+	keep_options(t)
+	options.wrap = false
+	COLS, ROWS, lineNumberWidth = 20, 10, 0
+	offsetRow, offsetCol = 0, 0
+	lines := []string{"a b c d", "", "x", "", "y", "", "  z"}
+	tests := []struct {
+		name  string
+		count int
+		from  position
+		want  position
+	}{
+		{"}", 2, position{0, 0}, position{3, 0}},
+		{"}", 9, position{0, 0}, position{6, 3}},
+		{"{", 2, position{6, 2}, position{3, 0}},
+		{"e", 2, position{0, 0}, position{0, 4}},
+		{"b", 2, position{0, 6}, position{0, 2}},
+		{"H", 0, position{4, 0}, position{0, 0}},
+		{"H", 3, position{4, 0}, position{2, 0}},
+		{"L", 0, position{0, 0}, position{6, 2}},
+		{"L", 3, position{0, 0}, position{4, 0}},
+		{"M", 0, position{0, 0}, position{3, 0}},
+		{"G", 99, position{0, 0}, position{6, 2}},
+	}
+	for _, test := range tests {
+		set_buffer(lines...)
+		currentRow, currentCol = test.from.row, test.from.col
+		target, ok := motionTable[test.name](test.count)
+		if !ok || target.position != test.want {
+			t.Errorf("%d%s from %v = %v (%v), want %v", test.count, test.name, test.from, target.position, ok, test.want)
+		}
+	}
+}
+
+func TestReadCountWithoutDigits(t *testing.T) {
+	pendingKeys = ""
+	for _, ch := range []rune{'x', '0'} {
+		event := input_event{Event: termbox.Event{Type: termbox.EventKey, Ch: ch}}
+		if count, next := read_count(event); count != 0 || next.Event != event.Event {
+			t.Errorf("read_count(%q) = %d, %+v", ch, count, next)
+		}
+	}
+	if pendingKeys != "" {
+		t.Errorf("pendingKeys = %q", pendingKeys)
+	}
+}
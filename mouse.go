@@ -0,0 +1,186 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+const (
+	multiClickInterval = 400 * time.Millisecond
+	wheelScrollRows    = 3
+)
+
+// click_region is a clickable span of a screen row outside the text area,
+// such as a status bar segment.
+type click_region struct {
+	row, start, end int
+	action          func()
+}
+
+var (
+	clickRegions   []click_region
+	lastClickTime  time.Time
+	lastClickX     int
+	lastClickY     int
+	clickCount     int
+	dragging       bool
+	dragAnchor     struct{ row, col int }
+	mouseInputMode bool
+)
+
+// update_input_mode turns terminal mouse reporting on or off to match the
+// mouse option.
+func update_input_mode() {
+	if options.mouse == mouseInputMode {
+		return
+	}
+	mouseInputMode = options.mouse
+	if options.mouse {
+		termbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
+	} else {
+		termbox.SetInputMode(termbox.InputEsc)
+	}
+}
+
+// add_click_region registers action to run when the given columns of row
+// are clicked. Regions are rebuilt on every redraw.
+func add_click_region(row int, start int, text string, action func()) {
+	clickRegions = append(clickRegions, click_region{row, start, start + runewidth.StringWidth(text), action})
+}
+
+// screen_to_buffer maps a screen cell in the text area to the text_buffer
+// position drawn there. Clicks past the end of a line land on its end and
+// clicks below the last line land on the last line.
+func screen_to_buffer(x, y int) (int, int) {
+	screenLines := layout_screen()
+	if y >= len(screenLines) {
+		y = len(screenLines) - 1
+	}
+	screenLine := screenLines[y]
+	if screenLine.row >= len(text_buffer) {
+		row := len(text_buffer) - 1
+		return row, len(text_buffer[row])
+	}
+
+	line := text_buffer[screenLine.row]
+	vcol := screenLine.startVcol + max(x-screenLine.x, 0)
+	col := col_from_visual(line, vcol)
+	if col > screenLine.endCol || options.wrap && col == screenLine.endCol && screenLine.endCol < len(line) {
+		col = prev_grapheme(line, screenLine.endCol)
+	}
+	return screenLine.row, col
+}
+
+func handle_mouse(event termbox.Event) {
+	switch event.Key {
+	case termbox.MouseWheelUp:
+		scroll_view(-wheelScrollRows)
+	case termbox.MouseWheelDown:
+		scroll_view(wheelScrollRows)
+	case termbox.MouseRelease:
+		dragging = false
+	case termbox.MouseLeft:
+		if event.Mod&termbox.ModMotion != 0 {
+			drag_to(event.MouseX, event.MouseY)
+			return
+		}
+		now := time.Now()
+		if event.MouseX == lastClickX && event.MouseY == lastClickY && now.Sub(lastClickTime) < multiClickInterval {
+			clickCount = clickCount%3 + 1
+		} else {
+			clickCount = 1
+		}
+		lastClickTime, lastClickX, lastClickY = now, event.MouseX, event.MouseY
+		click(event.MouseX, event.MouseY)
+	}
+}
+
+func click(x, y int) {
+	if y >= ROWS {
+		for _, region := range clickRegions {
+			if region.row == y && x >= region.start && x < region.end {
+				region.action()
+				return
+			}
+		}
+		return
+	}
+
+	currentRow, currentCol = screen_to_buffer(x, y)
+	switch clickCount {
+	case 1:
+		end_visual()
+		dragging = true
+		dragAnchor.row, dragAnchor.col = currentRow, currentCol
+	case 2:
+		// Select the run of word characters, punctuation or blanks clicked on
+		line := text_buffer[currentRow]
+		if len(line) == 0 {
+			return
+		}
+		col := min(currentCol, len(line)-1)
+		start, end := col, col
+		class := word_class(line[col], false)
+		for start > 0 && word_class(line[start-1], false) == class {
+			start--
+		}
+		for end < len(line)-1 && word_class(line[end+1], false) == class {
+			end++
+		}
+		select_range(currentRow, start, currentRow, end)
+	case 3:
+		select_range(currentRow, 0, currentRow, max(len(text_buffer[currentRow])-1, 0))
+	}
+}
+
+func drag_to(x, y int) {
+	if !dragging || y >= ROWS {
+		return
+	}
+	row, col := screen_to_buffer(max(x, 0), max(y, 0))
+	if mode != 4 {
+		if row == dragAnchor.row && col == dragAnchor.col {
+			return
+		}
+		mode = 4
+		visualKind = "v"
+		selectionStart.row, selectionStart.col = dragAnchor.row, dragAnchor.col
+	}
+	currentRow, currentCol = row, col
+	selectionEnd.row, selectionEnd.col = row, col
+}
+
+// select_range enters VISUAL mode with the inclusive selection given and the
+// cursor on its end.
+func select_range(startRow, startCol, endRow, endCol int) {
+	mode = 4
+	visualKind = "v"
+	selectionStart.row, selectionStart.col = startRow, startCol
+	selectionEnd.row, selectionEnd.col = endRow, endCol
+	currentRow, currentCol = endRow, endCol
+}
+
+// scroll_view scrolls the viewport by delta rows, dragging the cursor along
+// only as far as needed to keep it on screen.
+func scroll_view(delta int) {
+	offsetRow += delta
+	offsetRow = max(min(offsetRow, len(text_buffer)-1), 0)
+	offsetWrap = 0
+
+	top, bottom := offsetRow, offsetRow
+	for _, screenLine := range layout_screen() {
+		if screenLine.row < len(text_buffer) && !screenLine.continuation {
+			bottom = screenLine.row
+		}
+	}
+	if currentRow < top {
+		move_rows(top - currentRow)
+	} else if currentRow > bottom {
+		move_rows(bottom - currentRow)
+	}
+	if mode == 4 {
+		selectionEnd.row, selectionEnd.col = currentRow, currentCol
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// mouse_event returns a mouse event for key at x, y.
+func mouse_event(key termbox.Key, x, y int) termbox.Event {
+	return termbox.Event{Type: termbox.EventMouse, Key: key, MouseX: x, MouseY: y}
+}
+
+func TestScreenToBuffer(t *testing.T) {
+	keep_options(t)
+	COLS, ROWS, lineNumberWidth = 10, 4, 2
+	offsetRow, offsetCol, offsetWrap = 0, 0, 0
+	options.wrap, options.tabWidth = false, 4
+	set_buffer("\tab", "xyz")
+	tests := []struct {
+		x, y     int
+		row, col int
+	}{
+		{2, 0, 0, 0},
+		{5, 0, 0, 0},
+		{6, 0, 0, 1},
+		{9, 0, 0, 3},
+		{0, 1, 1, 0},
+		{3, 3, 1, 3},
+	}
+	for _, test := range tests {
+		if row, col := screen_to_buffer(test.x, test.y); row != test.row || col != test.col {
+			t.Errorf("screen_to_buffer(%d, %d) = %d,%d, want %d,%d", test.x, test.y, row, col, test.row, test.col)
+		}
+	}
+}
+
+func TestMouseSelect(t *testing.T) {
+	keep_options(t)
+	COLS, ROWS, lineNumberWidth = 20, 4, 0
+	offsetRow, offsetCol, offsetWrap = 0, 0, 0
+	options.wrap = false
+	set_buffer("foo bar_baz, qux", "second")
+	mode, lastClickTime = 0, time.Time{}
+
+	handle_mouse(mouse_event(termbox.MouseLeft, 6, 0))
+	if mode != 0 || currentCol != 6 {
+		t.Fatalf("click: mode %d col %d", mode, currentCol)
+	}
+	handle_mouse(mouse_event(termbox.MouseLeft, 6, 0))
+	if mode != 4 || selectionStart.col != 4 || selectionEnd.col != 10 {
+		t.Errorf("double click selected %v-%v in mode %d", selectionStart, selectionEnd, mode)
+	}
+	handle_mouse(mouse_event(termbox.MouseLeft, 6, 0))
+	if selectionStart.col != 0 || selectionEnd.col != 15 {
+		t.Errorf("triple click selected %v-%v", selectionStart, selectionEnd)
+	}
+
+	handle_mouse(mouse_event(termbox.MouseLeft, 1, 0))
+	if mode != 0 {
+		t.Errorf("click elsewhere after a triple click left mode %d", mode)
+	}
+	handle_mouse(mouse_event(termbox.MouseRelease, 1, 0))
+	lastClickTime = time.Time{}
+	handle_mouse(mouse_event(termbox.MouseLeft, 2, 0))
+	drag := mouse_event(termbox.MouseLeft, 3, 1)
+	drag.Mod = termbox.ModMotion
+	handle_mouse(drag)
+	if mode != 4 || selectionStart.row != 0 || selectionStart.col != 2 || selectionEnd.row != 1 || selectionEnd.col != 3 {
+		t.Errorf("drag selected %v-%v in mode %d", selectionStart, selectionEnd, mode)
+	}
+	mode = 0
+}
+
+func TestMouseWheel(t *testing.T) {
+	keep_options(t)
+	COLS, ROWS, lineNumberWidth = 10, 2, 0
+	options.wrap = false
+	set_buffer("a", "b", "c", "d", "e", "f")
+	offsetRow, offsetWrap = 0, 0
+	handle_mouse(mouse_event(termbox.MouseWheelDown, 0, 0))
+	if offsetRow != 3 || currentRow != 3 {
+		t.Errorf("wheel down: offset %d row %d, want 3 3", offsetRow, currentRow)
+	}
+	handle_mouse(mouse_event(termbox.MouseWheelUp, 0, 0))
+	if offsetRow != 0 || currentRow != 1 {
+		t.Errorf("wheel up: offset %d row %d, want 0 1", offsetRow, currentRow)
+	}
+}
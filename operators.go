@@ -0,0 +1,342 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// text_range is the span of text_buffer an operator acts on, from start up
+// to but not including end. Linewise ranges cover whole rows from start.row
+// to end.row.
+type text_range struct {
+	start, end position
+	linewise   bool
+}
+
+// operatorTable maps operator key names to the function applying them. A
+// doubled operator (dd, >>, guu) acts on count whole lines and any other
+// motion from motionTable supplies the range, so new operators and motions
+// combine without further wiring.
+var operatorTable = map[string]func(r text_range){
+	"d":  operator_delete,
+	"c":  operator_change,
+	"y":  operator_yank,
+	">":  func(r text_range) { operator_shift(r, 1) },
+	"<":  func(r text_range) { operator_shift(r, -1) },
+	"gu": func(r text_range) { operator_case(r, unicode.ToLower) },
+	"gU": func(r text_range) { operator_case(r, unicode.ToUpper) },
+	"g~": func(r text_range) { operator_case(r, toggle_case) },
+	"=":  operator_reindent,
+	"gc": operator_comment,
+}
+
+// run_operator reads the motion following operator op and applies op to
+// the text between the cursor and where the motion lands. A count typed
+// before the motion multiplies the one typed before op, so 2d3w deletes six
+// words.
+func run_operator(op string, count int) {
+	operatorPending = true
+	defer func() { operatorPending = false }()
+	motionCount, event := read_count(get_pending_key())
+	if motionCount > 0 {
+		count = min(max(count, 1)*motionCount, maxCount)
+	}
+	name := key_name(event)
+	if name == "g" {
+		pendingKeys += name
+		name += key_name(get_pending_key())
+	}
+
+	// cr is not c with a motion but the prefix for changing the style of
+	// the identifier under the cursor
+	if op == "c" && name == "r" {
+		pendingKeys += name
+		coerce_word()
+		return
+	}
+
+	var r text_range
+	if name == "i" || name == "a" {
+		pendingKeys += name
+		objectFunc, found := textObjectTable[name+key_name(get_pending_key())]
+		if !found {
+			return
+		}
+		var ok bool
+		if r, ok = objectFunc(count); !ok {
+			abort_pending_input()
+			return
+		}
+	} else if name == op || len(op) == 2 && name == op[1:] {
+		last := min(currentRow+max(count, 1)-1, len(text_buffer)-1)
+		r = text_range{position{currentRow, 0}, position{last, len(text_buffer[last])}, true}
+	} else {
+		// cw on a word changes to the end of the word like ce, leaving the
+		// blank after it alone
+		if op == "c" && (name == "w" || name == "W") && word_class(char_at(cursor()), false) != 0 {
+			name = map[string]string{"w": "e", "W": "E"}[name]
+		}
+		motionFunc, found := motionTable[name]
+		if !found {
+			return
+		}
+		target, ok := motionFunc(count)
+		if !ok {
+			abort_pending_input()
+			return
+		}
+		r = motion_range(cursor(), target)
+		// dw on the last word of a line stops at the end of that line
+		// instead of eating the line break and indent of the next one
+		if (name == "w" || name == "W") && r.end.row > r.start.row && r.end.col <= first_non_blank(r.end.row) {
+			r.end = position{r.end.row - 1, len(text_buffer[r.end.row-1])}
+		}
+	}
+	operatorTable[op](r)
+}
+
+// motion_range turns the cursor position and a motion target into the range
+// between them, in buffer order.
+func motion_range(from position, m motion) text_range {
+	start, end := from, m.position
+	if is_before(end, start) {
+		start, end = end, start
+	}
+	if m.linewise {
+		return text_range{start, end, true}
+	}
+	if m.inclusive {
+		end, _ = next_position(end)
+	}
+	return text_range{start, end, false}
+}
+
+func is_before(a, b position) bool {
+	return a.row < b.row || a.row == b.row && a.col < b.col
+}
+
+// range_text returns the text in r with rows separated by '\n'.
+func range_text(r text_range) []rune {
+	if r.linewise {
+		r.start.col, r.end.col = 0, len(text_buffer[r.end.row])
+	}
+	text := []rune{}
+	for row := r.start.row; row <= r.end.row; row++ {
+		lineStart, lineEnd := 0, len(text_buffer[row])
+		if row == r.start.row {
+			lineStart = r.start.col
+		}
+		if row == r.end.row {
+			lineEnd = r.end.col
+		}
+		text = append(text, text_buffer[row][lineStart:lineEnd]...)
+		if row < r.end.row {
+			text = append(text, '\n')
+		}
+	}
+	return text
+}
+
+// delete_range removes r from text_buffer. Callers are responsible for
+// push_buffer and for placing the cursor.
+func delete_range(r text_range) {
+	if r.linewise {
+		delete_lines(r.start.row, r.end.row)
+		return
+	}
+	joined := append([]rune{}, text_buffer[r.start.row][:r.start.col]...)
+	joined = append(joined, text_buffer[r.end.row][r.end.col:]...)
+	delete_lines(r.start.row+1, r.end.row)
+	text_buffer[r.start.row] = joined
+}
+
+// delete_lines removes rows first through last, leaving one empty row if
+// that would empty the buffer.
+func delete_lines(first, last int) {
+	if first > last {
+		return
+	}
+	marks_lines_deleted(first, last)
+	new_text_buffer := make([][]rune, 0, len(text_buffer)-(last-first+1))
+	new_text_buffer = append(new_text_buffer, text_buffer[:first]...)
+	new_text_buffer = append(new_text_buffer, text_buffer[last+1:]...)
+	if len(new_text_buffer) == 0 {
+		new_text_buffer = append(new_text_buffer, []rune{})
+	}
+	text_buffer = new_text_buffer
+}
+
+// insert_lines inserts lines before row at.
+func insert_lines(at int, lines [][]rune) {
+	marks_lines_inserted(at, len(lines))
+	new_text_buffer := make([][]rune, 0, len(text_buffer)+len(lines))
+	new_text_buffer = append(new_text_buffer, text_buffer[:at]...)
+	new_text_buffer = append(new_text_buffer, lines...)
+	new_text_buffer = append(new_text_buffer, text_buffer[at:]...)
+	text_buffer = new_text_buffer
+}
+
+// split_lines splits text at line breaks into the rows it would take up.
+func split_lines(text []rune) [][]rune {
+	lines := [][]rune{{}}
+	for _, r := range text {
+		if r == '\n' {
+			lines = append(lines, []rune{})
+		} else {
+			lines[len(lines)-1] = append(lines[len(lines)-1], r)
+		}
+	}
+	return lines
+}
+
+// insert_text inserts text, which may span several lines, at p and returns
+// the position just after it. Callers are responsible for push_buffer.
+func insert_text(p position, text []rune) position {
+	lines := split_lines(text)
+	line := text_buffer[p.row]
+	head := append(append([]rune{}, line[:p.col]...), lines[0]...)
+	tail := append([]rune{}, line[p.col:]...)
+	if len(lines) == 1 {
+		text_buffer[p.row] = append(head, tail...)
+		return position{p.row, len(head)}
+	}
+	text_buffer[p.row] = head
+	last := len(lines) - 1
+	end := position{p.row + last, len(lines[last])}
+	lines[last] = append(lines[last], tail...)
+	insert_lines(p.row+1, lines[1:])
+	return end
+}
+
+// yank_range copies r into the registers, see set_register.
+func yank_range(r text_range, deleting bool) {
+	set_register(range_text(r), r.linewise, deleting)
+}
+
+func operator_delete(r text_range) {
+	push_buffer()
+	yank_range(r, true)
+	delete_range(r)
+	currentRow = min(r.start.row, len(text_buffer)-1)
+	if r.linewise {
+		currentCol = first_non_blank(currentRow)
+	} else {
+		currentCol = r.start.col
+	}
+	modified = 0
+}
+
+func operator_change(r text_range) {
+	push_buffer()
+	yank_range(r, true)
+	if r.linewise {
+		// Keep the indent of the first line so typing starts in place
+		indent := append([]rune{}, text_buffer[r.start.row][:first_non_blank(r.start.row)]...)
+		delete_lines(r.start.row+1, r.end.row)
+		text_buffer[r.start.row] = indent
+		currentRow, currentCol = r.start.row, len(indent)
+	} else {
+		delete_range(r)
+		currentRow, currentCol = r.start.row, r.start.col
+	}
+	modified = 0
+	mode = 1
+}
+
+func operator_yank(r text_range) {
+	yank_range(r, false)
+	currentRow = r.start.row
+	if !r.linewise {
+		currentCol = r.start.col
+	}
+}
+
+// shift_width is the width of one level of indentation: the shiftwidth
+// option, or tabwidth when that is 0.
+func shift_width() int {
+	if options.shiftWidth > 0 {
+		return options.shiftWidth
+	}
+	return options.tabWidth
+}
+
+// make_indent builds indentation width columns wide, out of spaces with
+// expandtab and otherwise out of tabs topped up with spaces.
+func make_indent(width int) []rune {
+	if options.expandTab {
+		return []rune(strings.Repeat(" ", width))
+	}
+	return []rune(strings.Repeat("\t", width/options.tabWidth) + strings.Repeat(" ", width%options.tabWidth))
+}
+
+// indent_width is the number of columns taken up by the indentation of
+// line.
+func indent_width(line []rune) int {
+	return visual_col(line, len(leading_blanks(line)))
+}
+
+// operator_shift indents (levels > 0) or outdents (levels < 0) every
+// non-empty row touched by r by that many levels.
+func operator_shift(r text_range, levels int) {
+	push_buffer()
+	for row := r.start.row; row <= r.end.row; row++ {
+		if len(text_buffer[row]) == 0 {
+			continue
+		}
+		shift_line(row, levels)
+	}
+	currentRow, currentCol = r.start.row, first_non_blank(r.start.row)
+	modified = 0
+}
+
+// shift_line changes the indentation of row by levels of shift_width,
+// rebuilding it with make_indent so tabs and spaces follow expandtab.
+func shift_line(row int, levels int) {
+	line := text_buffer[row]
+	width := max(indent_width(line)+levels*shift_width(), 0)
+	text_buffer[row] = append(make_indent(width), line[len(leading_blanks(line)):]...)
+}
+
+// operator_case maps every character in r through convert.
+func operator_case(r text_range, convert func(rune) rune) {
+	push_buffer()
+	convert_spans(range_spans(r), convert)
+	if r.linewise {
+		r.start.col = 0
+	}
+	currentRow, currentCol = r.start.row, r.start.col
+	modified = 0
+}
+
+// operator_reindent re-indents the rows in r from the line above them,
+// adding a level after an opening bracket and removing one before a
+// closing bracket.
+func operator_reindent(r text_range) {
+	push_buffer()
+	for row := r.start.row; row <= r.end.row; row++ {
+		content := text_buffer[row][first_non_blank(row):]
+		if len(content) == 0 {
+			text_buffer[row] = []rune{}
+			continue
+		}
+
+		width := 0
+		above := row - 1
+		for above >= 0 && is_blank_line(above) {
+			above--
+		}
+		if above >= 0 {
+			previous := text_buffer[above]
+			width = indent_width(previous)
+			if strings.ContainsRune(current_language().indentAfter, previous[len(previous)-1]) {
+				width += shift_width()
+			}
+		}
+		if strings.ContainsRune(current_language().dedentOn, content[0]) {
+			width = max(width-shift_width(), 0)
+		}
+		text_buffer[row] = append(make_indent(width), content...)
+	}
+	currentRow, currentCol = r.start.row, first_non_blank(r.start.row)
+	modified = 0
+}
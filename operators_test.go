@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOperators(t *testing.T) {
+	keep_options(t)
+	options.tabWidth, options.expandTab = 4, true
+	tests := []struct {
+		op    string
+		lines []string
+		from  position
+		to    motion
+		want  []string
+	}{
+		{"d", []string{"foo bar baz"}, position{0, 4}, motion{position: position{0, 8}}, []string{"foo baz"}},
+		{"d", []string{"foo bar"}, position{0, 4}, motion{position: position{0, 0}}, []string{"bar"}},
+		{"d", []string{"foo bar"}, position{0, 1}, motion{position: position{0, 4}, inclusive: true}, []string{"far"}},
+		{"d", []string{"one", "two", "three"}, position{0, 1}, motion{position: position{1, 0}, linewise: true}, []string{"three"}},
+		{"d", []string{"one", "two"}, position{0, 2}, motion{position: position{1, 1}}, []string{"onwo"}},
+		{"c", []string{"  one", "  two", "x"}, position{0, 3}, motion{position: position{1, 0}, linewise: true}, []string{"  ", "x"}},
+		{">", []string{"a", "", "b"}, position{0, 0}, motion{position: position{2, 0}, linewise: true}, []string{"    a", "", "    b"}},
+		{"<", []string{"      a", "\tb", "  c"}, position{0, 0}, motion{position: position{2, 0}, linewise: true}, []string{"  a", "b", "c"}},
+		{"gU", []string{"foo bar"}, position{0, 0}, motion{position: position{0, 2}, inclusive: true}, []string{"FOO bar"}},
+		{"gu", []string{"FOO", "BAR"}, position{0, 0}, motion{position: position{1, 0}, linewise: true}, []string{"foo", "bar"}},
+		{"=", []string{"f() {", "x", "      y", "}"}, position{0, 0}, motion{position: position{3, 0}, linewise: true}, []string{"f() {", "    x", "    y", "}"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		currentRow, currentCol = test.from.row, test.from.col
+		mode = 0
+		operatorTable[test.op](motion_range(test.from, test.to))
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s on %q = %q, want %q", test.op, test.lines, got, test.want)
+		}
+	}
+	mode = 0
+}
+
+func TestRangeText(t *testing.T) {
+	set_buffer("one", "two", "three")
+	tests := []struct {
+		r    text_range
+		want string
+	}{
+		{text_range{position{0, 1}, position{0, 3}, false}, "ne"},
+		{text_range{position{0, 2}, position{2, 2}, false}, "e\ntwo\nth"},
+		{text_range{position{1, 2}, position{2, 0}, true}, "two\nthree"},
+	}
+	for _, test := range tests {
+		if got := string(range_text(test.r)); got != test.want {
+			t.Errorf("range_text(%v) = %q, want %q", test.r, got, test.want)
+		}
+	}
+}
+
+func TestShiftWidth(t *testing.T) {
+	keep_options(t)
+	saved := file_extension
+	t.Cleanup(func() { file_extension = saved })
+	file_extension = "go"
+	tests := []struct {
+		shiftWidth int
+		tabWidth   int
+		expandTab  bool
+		lines      []string
+		keys       string
+		want       []string
+	}{
+		{2, 4, true, []string{"a", "b"}, ">>", []string{"  a", "b"}},
+		{2, 4, true, []string{"a", "b", "c"}, "2>>", []string{"  a", "  b", "c"}},
+		{0, 4, true, []string{"a"}, ">>", []string{"    a"}},
+		{0, 8, false, []string{"a"}, ">>", []string{"\ta"}},
+		{2, 4, false, []string{"a"}, ">>", []string{"  a"}},
+		{2, 4, false, []string{"  a"}, ">>", []string{"\ta"}},
+		{2, 4, false, []string{"\t  a"}, "<<", []string{"\ta"}},
+		{2, 4, true, []string{" a"}, "<<", []string{"a"}},
+		{2, 4, true, []string{"a", "b", "c"}, "Vj3>", []string{"      a", "      b", "c"}},
+		{2, 4, true, []string{"        a", "        b"}, "Vj2<", []string{"    a", "    b"}},
+		{2, 4, true, []string{"a", "b", "c"}, "Vj>3.", []string{"        a", "        b", "c"}},
+		{2, 4, true, []string{"a", "b", "c", "d"}, "Vj2>jj.", []string{"    a", "    b", "    c", "    d"}},
+		{2, 4, true, []string{"ab", "cd"}, "l\x16j2>", []string{"    ab", "    cd"}},
+		{0, 4, true, []string{"a", "b"}, "Vj>", []string{"    a", "    b"}},
+		{2, 4, true, []string{"f() {", "x", "}"}, "=G", []string{"f() {", "  x", "}"}},
+		{2, 4, true, []string{"f() {"}, "ox\x1b", []string{"f() {", "  x"}},
+		{0, 4, true, []string{"f() {"}, "ox\x1b", []string{"f() {", "    x"}},
+		{2, 4, false, []string{"\tf() {"}, "ox\x1b", []string{"\tf() {", "\t  x"}},
+	}
+	for _, test := range tests {
+		options.shiftWidth, options.tabWidth, options.expandTab = test.shiftWidth, test.tabWidth, test.expandTab
+		set_buffer(test.lines...)
+		lastChange = nil
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q on %q with sw=%d ts=%d et=%v = %q, want %q", test.keys, test.lines, test.shiftWidth, test.tabWidth, test.expandTab, got, test.want)
+		}
+	}
+	if err := set_option("sw=-1"); err == nil {
+		t.Errorf("set sw=-1: no error")
+	}
+	if err := set_option("sw=0"); err != nil || options.shiftWidth != 0 {
+		t.Errorf("set sw=0: %v, shiftwidth %d", err, options.shiftWidth)
+	}
+}
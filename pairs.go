@@ -0,0 +1,138 @@
+package main
+
+import "strings"
+
+// pairs_enabled reports whether brackets and quotes are typed in pairs in
+// the file being edited, going by the autopairs and autopairsoff options.
+func pairs_enabled() bool {
+	if !options.autoPairs {
+		return false
+	}
+	for _, extension := range strings.Split(options.autoPairsOff, ",") {
+		if extension = strings.TrimSpace(extension); extension != "" && strings.EqualFold(extension, file_extension) {
+			return false
+		}
+	}
+	return true
+}
+
+// pair_close returns the character that closes open in the current
+// language, or 0 if open doesn't start a pair.
+func pair_close(open rune) rune {
+	pairs := []rune(current_language().pairs)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i] == open {
+			return pairs[i+1]
+		}
+	}
+	return 0
+}
+
+// is_pair_close reports whether ch closes one of the current language's
+// pairs.
+func is_pair_close(ch rune) bool {
+	pairs := []rune(current_language().pairs)
+	for i := 1; i < len(pairs); i += 2 {
+		if pairs[i] == ch {
+			return true
+		}
+	}
+	return false
+}
+
+// string_quote returns the quote of the string that col on line is inside,
+// or 0 outside strings. Quotes escaped with a backslash are skipped.
+func string_quote(line []rune, col int) rune {
+	var quote rune
+	for i := 0; i < col && i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++
+		case quote != 0:
+			if line[i] == quote {
+				quote = 0
+			}
+		case pair_close(line[i]) == line[i]:
+			quote = line[i]
+		}
+	}
+	return quote
+}
+
+// type_pair handles a character typed in INSERT mode that is part of a
+// pair. Typing a closing character in front of the same one steps over it,
+// and an opening one also inserts its closing one when the cursor is not
+// in front of a word or inside a string. It reports whether it inserted
+// or skipped anything.
+func type_pair(ch rune) bool {
+	if !pairs_enabled() {
+		return false
+	}
+	line := text_buffer[currentRow]
+	next := char_at(cursor())
+	if is_pair_close(ch) && next == ch && (pair_close(ch) != ch || string_quote(line, currentCol) == ch) {
+		currentCol++
+		return true
+	}
+	close := pair_close(ch)
+	if close == 0 || string_quote(line, currentCol) != 0 {
+		return false
+	}
+	if next != '\n' && word_class(next, false) != 0 && !is_pair_close(next) {
+		return false
+	}
+	// A quote right after a word is an apostrophe or closes something else
+	if close == ch && currentCol > 0 && is_word_char(line[currentCol-1]) {
+		return false
+	}
+	insert_runes([]rune{ch, close})
+	currentCol--
+	return true
+}
+
+// between_pair reports whether the cursor sits between an opening
+// character and its closing one with nothing in between.
+func between_pair() bool {
+	line := text_buffer[currentRow]
+	if !pairs_enabled() || currentCol == 0 || currentCol >= len(line) {
+		return false
+	}
+	close := pair_close(line[currentCol-1])
+	return close != 0 && line[currentCol] == close
+}
+
+// delete_pair deletes both characters of an empty pair around the cursor
+// for Backspace.
+func delete_pair() bool {
+	if !between_pair() {
+		return false
+	}
+	push_buffer()
+	line := text_buffer[currentRow]
+	text_buffer[currentRow] = append(line[:currentCol-1:currentCol-1], line[currentCol+1:]...)
+	currentCol--
+	return true
+}
+
+// open_block handles Enter between a pair of brackets by putting the
+// closing bracket on a line of its own and leaving the cursor on an
+// indented line between them.
+func open_block() bool {
+	line := text_buffer[currentRow]
+	if !between_pair() || !strings.ContainsRune(current_language().indentAfter, line[currentCol-1]) {
+		return false
+	}
+	push_buffer()
+	left := append([]rune{}, line[:currentCol]...)
+	indent := leading_blanks(line)
+	if options.autoIndent {
+		indent = make_indent(indent_width(line) + shift_width())
+	}
+	closing := append(leading_blanks(line), line[currentCol:]...)
+	text_buffer[currentRow] = left
+	insert_lines(currentRow+1, [][]rune{indent, closing})
+	currentRow++
+	currentCol = len(indent)
+	autoIndented = true
+	return true
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAutoPairs(t *testing.T) {
+	keep_options(t)
+	saved := file_extension
+	t.Cleanup(func() { file_extension = saved })
+	file_extension = "go"
+	options.expandTab, options.tabWidth = true, 4
+	tests := []struct {
+		lines []string
+		keys  string
+		want  []string
+	}{
+		{[]string{""}, "i(\x1b", []string{"()"}},
+		{[]string{""}, "i(x)\x1b", []string{"(x)"}},
+		{[]string{""}, "i\"a\"\x1b", []string{"\"a\""}},
+		{[]string{""}, "i[(\x1b", []string{"[()]"}},
+		{[]string{"foo"}, "i(\x1b", []string{"(foo"}},
+		{[]string{")"}, "i(\x1b", []string{"())"}},
+		{[]string{"\"a\""}, "li(\x1b", []string{"\"(a\""}},
+		{[]string{"don"}, "$i't\x1b", []string{"don't"}},
+		{[]string{""}, "i(\x7f\x1b", []string{""}},
+		{[]string{""}, "i()\x7f\x1b", []string{"("}},
+		{[]string{""}, "i{\rx\x1b", []string{"{", "    x", "}"}},
+		{[]string{"  f()"}, "$i{\r\x1b", []string{"  f(){", "", "  }"}},
+		{[]string{" a", " b", " c"}, "\x16jjIf(\x1b", []string{"f() a", "f() b", "f() c"}},
+		{[]string{"a", "b", "c"}, "\x16jjIf(x)\x1b", []string{"f(x)a", "f(x)b", "f(x)c"}},
+		{[]string{" a", " b"}, "\x16jIf(x\x1b", []string{"f(x) a", "f(x) b"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q on %q = %q, want %q", test.keys, test.lines, got, test.want)
+		}
+	}
+}
+
+func TestAutoPairsOff(t *testing.T) {
+	keep_options(t)
+	saved := file_extension
+	t.Cleanup(func() { file_extension = saved })
+	tests := []struct {
+		extension string
+		setting   string
+		want      string
+	}{
+		{"go", "ap", "()"},
+		{"go", "noap", "("},
+		{"go", "apo=md,go", "("},
+		{"md", "apo=md", "("},
+		{"txt", "ap", "\"\""},
+		{"rs", "ap", "'"},
+	}
+	for _, test := range tests {
+		options.autoPairs, options.autoPairsOff = true, ""
+		if err := set_option(test.setting); err != nil {
+			t.Fatalf("set %s: %v", test.setting, err)
+		}
+		file_extension = test.extension
+		keys := "i(\x1b"
+		if test.want[0] != '(' {
+			keys = "i" + test.want[:1] + "\x1b"
+		}
+		set_buffer("")
+		run_keys(t, keys)
+		if got := string(text_buffer[0]); got != test.want {
+			t.Errorf("%q in .%s with %s = %q, want %q", keys, test.extension, test.setting, got, test.want)
+		}
+	}
+}
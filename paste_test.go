@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPaste(t *testing.T) {
+	tests := []struct {
+		lines []string
+		keys  string
+		want  []string
+		at    position
+	}{
+		{[]string{"one two"}, `"ayw$"ap`, []string{"one twoone "}, position{0, 10}},
+		{[]string{"one two"}, `"ayw"aP`, []string{"one one two"}, position{0, 3}},
+		{[]string{"one two"}, `"ayw3"aP`, []string{"one one one one two"}, position{0, 11}},
+		{[]string{"ab", "cd"}, `lvj"ayj"ap`, []string{"ab", "cdb", "cd"}, position{1, 2}},
+		{[]string{"one", "two", "three"}, `"a2yyG"ap`, []string{"one", "two", "three", "one", "two"}, position{3, 0}},
+		{[]string{"one", "  two"}, `j"ayyk"aP`, []string{"  two", "one", "  two"}, position{0, 2}},
+		{[]string{"one", "two"}, `"ayy2"ap`, []string{"one", "one", "one", "two"}, position{1, 0}},
+		{[]string{"日本"}, `"ayl"ap`, []string{"日日本"}, position{0, 1}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		registers = map[rune]register{}
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) || cursor() != test.at {
+			t.Errorf("%s on %q = %q at %v, want %q at %v", test.keys, test.lines, got, cursor(), test.want, test.at)
+		}
+	}
+}
+
+func TestClipboardRegister(t *testing.T) {
+	tests := []struct {
+		text string
+		want register
+	}{
+		{"abc", register{[]rune("abc"), false}},
+		{"a\nb\n", register{[]rune("a\nb"), true}},
+		{"a\r\nb\r\n", register{[]rune("a\nb"), true}},
+		{"a\rb", register{[]rune("a\nb"), false}},
+		{"\n", register{[]rune(""), true}},
+	}
+	for _, test := range tests {
+		if got := clipboard_register(test.text); string(got.text) != string(test.want.text) || got.linewise != test.want.linewise {
+			t.Errorf("clipboard_register(%q) = %q linewise %v, want %q linewise %v", test.text, string(got.text), got.linewise, string(test.want.text), test.want.linewise)
+		}
+	}
+}
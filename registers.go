@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nsf/termbox-go"
+)
+
+// register is yanked or deleted text, remembering whether it was whole
+// lines.
+type register struct {
+	text     []rune
+	linewise bool
+}
+
+const yankRingSize = 10
+
+var (
+	registers = map[rune]register{}
+	// selectedRegister is the register named with " before the current
+	// command, or 0 for the unnamed one.
+	selectedRegister rune
+	// clipboardText is what was last put on the system clipboard, so text
+	// copied in another program since can be told apart.
+	clipboardText string
+	// yankRing holds the latest yanks and deletes, newest first, for cycling
+	// through after a paste.
+	yankRing  []register
+	lastPaste struct {
+		changeCount, count, ring int
+		below                    bool
+	}
+)
+
+// is_register reports whether name can follow " to select a register.
+func is_register(name rune) bool {
+	return strings.ContainsRune(`"_+`, name) || name >= '0' && name <= '9' || name >= 'a' && name <= 'z' || name >= 'A' && name <= 'Z'
+}
+
+// set_register stores yanked or deleted text the way vim does: in the
+// selected register and the unnamed one, where an uppercase name appends to
+// the lowercase register and "_ stores nothing. Without a register name a
+// yank also goes to "0 and a delete shifts "1 to "9 along, and the text is
+// put on the system clipboard.
+func set_register(text []rune, linewise bool, deleting bool) {
+	name := selectedRegister
+	if name == '_' {
+		return
+	}
+	value := register{append([]rune{}, text...), linewise}
+
+	switch {
+	case name >= 'A' && name <= 'Z':
+		name = unicode.ToLower(name)
+		if old := registers[name]; len(old.text) > 0 {
+			joined := append([]rune{}, old.text...)
+			if old.linewise || linewise {
+				joined = append(joined, '\n')
+			}
+			value = register{append(joined, text...), old.linewise || linewise}
+		}
+		registers[name] = value
+	case name == '+':
+		write_register_to_clipboard(value)
+	case name != 0 && name != '"':
+		registers[name] = value
+	default:
+		if deleting {
+			for n := '9'; n > '1'; n-- {
+				registers[n] = registers[n-1]
+			}
+			registers['1'] = value
+		} else {
+			registers['0'] = value
+		}
+		write_register_to_clipboard(value)
+	}
+	registers['"'] = value
+
+	yankRing = append([]register{value}, yankRing...)
+	if len(yankRing) > yankRingSize {
+		yankRing = yankRing[:yankRingSize]
+	}
+}
+
+// get_register returns the contents of register name. The unnamed register
+// gives way to the system clipboard when something else was copied there
+// since the last yank.
+func get_register(name rune) register {
+	switch {
+	case name == 0 || name == '"':
+		if text, err := read_clipboard(); err == nil && text != "" && text != clipboardText {
+			return clipboard_register(text)
+		}
+		name = '"'
+	case name == '+':
+		text, _ := read_clipboard()
+		return clipboard_register(text)
+	case name >= 'A' && name <= 'Z':
+		name = unicode.ToLower(name)
+	}
+	return registers[name]
+}
+
+// write_register_to_clipboard puts value on the system clipboard, ending
+// whole lines with a line break so they come back as lines.
+func write_register_to_clipboard(value register) {
+	text := value.text
+	if value.linewise {
+		text = append(append([]rune{}, text...), '\n')
+	}
+	write_to_clipboard(text)
+}
+
+// clipboard_register turns text from the system clipboard into a register
+// with '\n' line breaks, where text ending in a line break is whole lines.
+func clipboard_register(text string) register {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	if strings.HasSuffix(text, "\n") {
+		return register{[]rune(strings.TrimSuffix(text, "\n")), true}
+	}
+	return register{text: []rune(text)}
+}
+
+// paste puts value count times above or below the cursor, remembering the
+// paste so cycle_paste can swap it for an older yank.
+func paste(value register, count int, below bool) {
+	if len(value.text) == 0 && !value.linewise {
+		return
+	}
+	if below {
+		paste_line_below(value, count)
+	} else {
+		paste_line(value, count)
+	}
+	modified = 0
+
+	lastPaste.changeCount, lastPaste.count, lastPaste.below = changeCount, count, below
+	lastPaste.ring = -1
+	for i, entry := range yankRing {
+		if string(entry.text) == string(value.text) {
+			lastPaste.ring = i
+			break
+		}
+	}
+}
+
+// paste_in_insert pastes the unnamed register at the cursor for Ctrl+V in
+// INSERT mode, leaving the cursor after it. Whole lines end with a line
+// break so typing carries on at the start of the next line.
+func paste_in_insert() {
+	value := get_register(0)
+	text := value.text
+	if value.linewise {
+		text = append(append([]rune{}, text...), '\n')
+	}
+	if len(text) == 0 {
+		return
+	}
+	push_buffer()
+	end := insert_text(cursor(), text)
+	currentRow, currentCol = end.row, end.col
+	modified = 0
+}
+
+// cycle_paste replaces the text just pasted with the next older (step 1) or
+// newer (step -1) entry of the yank ring.
+func cycle_paste(step int) {
+	index := lastPaste.ring + step
+	if changeCount != lastPaste.changeCount || index < 0 || index >= len(yankRing) {
+		statusMessage = "Nothing to cycle to"
+		return
+	}
+	pull_buffer()
+	paste(yankRing[index], lastPaste.count, lastPaste.below)
+	lastPaste.ring = index
+	statusMessage = fmt.Sprintf("Yank ring %d/%d", index+1, len(yankRing))
+}
+
+// show_registers lists the contents of every register that has any until a
+// key is pressed.
+func show_registers() {
+	names := []rune{'"'}
+	for n := '0'; n <= '9'; n++ {
+		names = append(names, n)
+	}
+	for n := 'a'; n <= 'z'; n++ {
+		names = append(names, n)
+	}
+	lines := []string{"Type Name Content"}
+	for _, name := range append(names, '+') {
+		value := get_register(name)
+		if name == '"' {
+			value = registers['"']
+		}
+		if len(value.text) == 0 {
+			continue
+		}
+		kind := "c"
+		if value.linewise {
+			kind = "l"
+		}
+		content := strings.ReplaceAll(string(value.text), "\n", "^J")
+		content = strings.ReplaceAll(content, "\t", "^I")
+		lines = append(lines, fmt.Sprintf("  %s  \"%c   %s", kind, name, content))
+	}
+
+	for {
+		termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+		update_size()
+		height := ROWS + 1
+		first := max(len(lines)-(height-1), 0)
+		for y, line := range lines[first:] {
+			print_message(0, y, termbox.ColorWhite, termbox.ColorDefault, runewidth.Truncate(line, COLS, ""))
+		}
+		print_message(0, height-1, termbox.ColorWhite, termbox.ColorDefault, " Press any key to continue")
+		termbox.HideCursor()
+		termbox.Flush()
+		if event := get_key(); event.Type == termbox.EventKey {
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRegisters(t *testing.T) {
+	tests := []struct {
+		lines []string
+		keys  string
+		want  []string
+	}{
+		{[]string{"one", "two"}, `"ayyj"ap`, []string{"one", "two", "one"}},
+		{[]string{"one", "two"}, `"ayyj"aP`, []string{"one", "one", "two"}},
+		{[]string{"one", "two"}, `"ayy"_ddG"ap`, []string{"two", "one"}},
+		{[]string{"one", "two"}, `"add"ap`, []string{"two", "one"}},
+		{[]string{"one", "two"}, `"ayy3"ap`, []string{"one", "one", "one", "one", "two"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		registers = map[rune]register{}
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s on %q = %q, want %q", test.keys, test.lines, got, test.want)
+		}
+	}
+}
+
+func TestRegisterContents(t *testing.T) {
+	tests := []struct {
+		lines []string
+		keys  string
+		name  rune
+		want  register
+	}{
+		{[]string{"one", "two", "three"}, `"a2yy`, 'a', register{[]rune("one\ntwo"), true}},
+		{[]string{"one", "two", "three"}, `2"ayy`, 'a', register{[]rune("one\ntwo"), true}},
+		{[]string{"one", "two"}, `"ayyj"Ayy`, 'a', register{[]rune("one\ntwo"), true}},
+		{[]string{"one two"}, `"adw"Adw`, 'a', register{[]rune("one two"), false}},
+		{[]string{"one two"}, `"bde`, '"', register{[]rune("one"), false}},
+		{[]string{"one two"}, `"ayy"_dd`, '"', register{[]rune("one two"), true}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		registers = map[rune]register{}
+		run_keys(t, test.keys)
+		if got := registers[test.name]; string(got.text) != string(test.want.text) || got.linewise != test.want.linewise {
+			t.Errorf("%s on %q left %q in \"%c linewise %v, want %q linewise %v", test.keys, test.lines, string(got.text), test.name, got.linewise, string(test.want.text), test.want.linewise)
+		}
+	}
+}
+
+func TestCyclePaste(t *testing.T) {
+	set_buffer("one", "two", "")
+	registers, yankRing = map[rune]register{}, nil
+	run_keys(t, `"ayyj"byyG"bp`)
+	run_keys(t, "\x10")
+	if got := buffer_lines(); !reflect.DeepEqual(got, []string{"one", "two", "", "one"}) {
+		t.Errorf("Ctrl+P after a paste = %q", got)
+	}
+	run_keys(t, "\x0e")
+	if got := buffer_lines(); !reflect.DeepEqual(got, []string{"one", "two", "", "two"}) {
+		t.Errorf("Ctrl+N after Ctrl+P = %q", got)
+	}
+	run_keys(t, "\x0e")
+	if statusMessage != "Nothing to cycle to" {
+		t.Errorf("Ctrl+N past the newest yank: status %q", statusMessage)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/nsf/termbox-go"
+)
+
+var (
+	// pendingInput holds keys for get_key to return before reading the
+	// terminal, so recorded commands replay through the usual key handling.
+	pendingInput []input_event
+	// changeCount goes up with every change pushed onto the undo stack,
+	// which is how a command is told apart from a plain motion.
+	changeCount int
+	changeStart int
+	changeKeys  []input_event
+	changeValid bool
+	// changeSelection selects the text a change made in VISUAL mode acted
+	// on, to go before its keys when it is repeated.
+	changeSelection []input_event
+	// changeCountTyped is the count the recorded command was typed with,
+	// kept apart from its keys so . can replace it.
+	changeCountTyped int
+	lastChange       []input_event
+	lastChangeCount  int
+	lastSelection    []input_event
+)
+
+// begin_change starts recording the keys of a new command, unless the
+// INSERT mode started by the last one is still going, in which case the
+// typed text belongs to that command.
+func begin_change() {
+	if mode == 1 {
+		return
+	}
+	changeKeys = nil
+	changeCountTyped = 0
+	changeStart = changeCount
+	changeValid = mode == 0 || mode == 4
+	changeSelection = nil
+	if mode == 4 {
+		changeSelection = selection_keys()
+	}
+}
+
+// selection_keys returns the keys that select as much text from the cursor
+// as the VISUAL selection does: as many lines and, for characters, up to the
+// same column on the last line or as many as on a single line, or for a
+// block as many characters across as on its top row.
+func selection_keys() []input_event {
+	start, end := position(selectionStart), position(selectionEnd)
+	if is_before(end, start) {
+		start, end = end, start
+	}
+	keys := visualKind
+	if end.row > start.row {
+		keys += strconv.Itoa(end.row-start.row) + "j"
+	}
+	across := 0
+	switch visualKind {
+	case "v":
+		from := start.col
+		if end.row > start.row {
+			keys += "0"
+			from = 0
+		}
+		line := text_buffer[end.row]
+		for col := from; col < min(end.col, len(line)); col = grapheme_end(line, col) {
+			across++
+		}
+	case "<C-v>":
+		top, _, left, right := visual_block()
+		span := block_span(top, left, right)
+		for col := span.start; col < span.end; col = grapheme_end(text_buffer[top], col) {
+			across++
+		}
+		across--
+	}
+	if across > 0 {
+		keys += strconv.Itoa(across) + "l"
+	}
+	return parse_keys(keys)
+}
+
+// record_key adds a key read by get_key to the command being recorded.
+func record_key(event input_event) {
+	if event.Type == termbox.EventKey {
+		changeKeys = append(changeKeys, event)
+	}
+}
+
+// record_count takes the digits of a count read by read_count out of the
+// command being recorded, where they are the keys before the last one, and
+// keeps the count instead. Counts typed before an operator and its motion
+// multiply, as they do when the command runs.
+func record_count(count int, digits int) {
+	end := len(changeKeys) - 1
+	if count == 0 || end < digits {
+		return
+	}
+	for _, event := range changeKeys[end-digits : end] {
+		if event.Mod != 0 || event.Ch < '0' || event.Ch > '9' {
+			return
+		}
+	}
+	changeKeys = append(changeKeys[:end-digits], changeKeys[end])
+	changeCountTyped = min(max(changeCountTyped, 1)*count, maxCount)
+}
+
+// end_change keeps the recorded keys for . once a command that changed
+// the buffer, including any INSERT mode it started, is finished. A change
+// that can't be replayed, such as one that stays in VISUAL mode, leaves
+// nothing to repeat rather than an older change.
+func end_change() {
+	if mode == 1 || changeCount == changeStart {
+		return
+	}
+	if !changeValid || mode == 4 {
+		lastChange = nil
+		return
+	}
+	lastChange = changeKeys
+	lastChangeCount = changeCountTyped
+	lastSelection = changeSelection
+}
+
+// abort_pending_input drops the rest of a replayed macro or change, for when
+// one of its commands fails.
+func abort_pending_input() {
+	pendingInput = nil
+}
+
+// repeat_change queues the keys of the last change to be run again. A count
+// replaces the one the change was typed with.
+func repeat_change(count int) {
+	if len(lastChange) == 0 {
+		return
+	}
+	if count == 0 {
+		count = lastChangeCount
+	}
+	keys := append([]input_event{}, lastSelection...)
+	if count > 0 {
+		keys = append(keys, parse_keys(strconv.Itoa(count))...)
+	}
+	keys = append(keys, lastChange...)
+	pendingInput = append(keys, pendingInput...)
+}
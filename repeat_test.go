@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRepeatChange(t *testing.T) {
+	keep_options(t)
+	options.tabWidth, options.expandTab = 4, true
+	tests := []struct {
+		lines []string
+		keys  string
+		want  []string
+	}{
+		{[]string{"a b c d e f"}, "dw.", []string{"c d e f"}},
+		{[]string{"a b c d e f"}, "dw3.", []string{"e f"}},
+		{[]string{"a b c d e f g h"}, "2dw.", []string{"e f g h"}},
+		{[]string{"a b c d e f g h"}, "2dw1.", []string{"d e f g h"}},
+		{[]string{"a b c d e f g h i j k l m"}, "2d3w.", []string{"m"}},
+		{[]string{"1", "2", "3", "4", "5", "6"}, "2dd.", []string{"5", "6"}},
+		{[]string{"1", "2", "3", "4", "5", "6"}, "2dd3.", []string{"6"}},
+		{[]string{"x"}, "ihello\x1b.", []string{"hellohellox"}},
+		{[]string{"x"}, "ihi\x1b3.", []string{"hihix"}},
+		{[]string{"x", "y"}, "oab\x1bj.", []string{"x", "ab", "y", "ab"}},
+		{[]string{"one two", "three"}, "cwxy\x1bj0.", []string{"xy two", "xy"}},
+		{[]string{"a", "b"}, ">>j.", []string{"    a", "    b"}},
+		{[]string{"a b c"}, "dwu.", []string{"b c"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		lastChange = nil
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q on %q = %q, want %q", test.keys, test.lines, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestStatusSegments(t *testing.T) {
+	nop := func() {}
+	segments := []status_segment{
+		{text: "mode", priority: 0, action: nop},
+		{text: "name", priority: 1},
+		{text: "undo", priority: 4, action: nop},
+		{text: "pct", priority: 3, right: true, action: nop},
+	}
+	tests := []struct {
+		cols int
+		want []click_region
+	}{
+		{20, []click_region{{row: 1, start: 0, end: 4}, {row: 1, start: 8, end: 12}, {row: 1, start: 17, end: 20}}},
+		{12, []click_region{{row: 1, start: 0, end: 4}, {row: 1, start: 9, end: 12}}},
+		{8, []click_region{{row: 1, start: 0, end: 4}}},
+		{3, []click_region{{row: 1, start: 0, end: 3}}},
+	}
+	for _, test := range tests {
+		COLS, ROWS = test.cols, 1
+		print_status_segments(append([]status_segment(nil), segments...))
+		if len(clickRegions) != len(test.want) {
+			t.Errorf("COLS=%d: %d click regions, want %d", test.cols, len(clickRegions), len(test.want))
+			continue
+		}
+		for i, region := range clickRegions {
+			want := test.want[i]
+			if region.row != want.row || region.start != want.start || region.end != want.end {
+				t.Errorf("COLS=%d: region %d = %d:%d-%d, want %d:%d-%d", test.cols, i, region.row, region.start, region.end, want.row, want.start, want.end)
+			}
+		}
+	}
+}
+
+func TestScrollTinyTerminal(t *testing.T) {
+	keep_options(t)
+	options.wrap = false
+	set_buffer("abc")
+	COLS, ROWS, lineNumberWidth = 0, 0, 0
+	offsetRow, offsetCol = 0, 0
+	scroll_text_buffer()
+	if offsetRow != 0 || offsetCol != 0 {
+		t.Errorf("scrolling with no text rows moved the view to %d,%d", offsetRow, offsetCol)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import "strings"
+
+// textObjectTable maps "i" or "a" followed by a key to a text object: the
+// range an operator acts on (ci", da() or a VISUAL selection expands to. The
+// "i" objects cover the inside of the object and the "a" objects include
+// its delimiters or the blanks around it.
+var textObjectTable = map[string]func(count int) (text_range, bool){
+	"iw": func(count int) (text_range, bool) { return object_word(count, false, false) },
+	"aw": func(count int) (text_range, bool) { return object_word(count, true, false) },
+	"iW": func(count int) (text_range, bool) { return object_word(count, false, true) },
+	"aW": func(count int) (text_range, bool) { return object_word(count, true, true) },
+	"ip": func(count int) (text_range, bool) { return object_paragraph(count, false) },
+	"ap": func(count int) (text_range, bool) { return object_paragraph(count, true) },
+	"it": func(count int) (text_range, bool) { return object_tag(count, false) },
+	"at": func(count int) (text_range, bool) { return object_tag(count, true) },
+}
+
+func init() {
+	for _, quote := range []rune{'"', '\'', '`'} {
+		quote := quote
+		textObjectTable["i"+string(quote)] = func(count int) (text_range, bool) { return object_quote(quote, false) }
+		textObjectTable["a"+string(quote)] = func(count int) (text_range, bool) { return object_quote(quote, true) }
+	}
+	for _, pair := range []string{"()b", "{}B", "[]", "<>"} {
+		open, close := rune(pair[0]), rune(pair[1])
+		names := []string{string(open), string(close)}
+		if len(pair) > 2 {
+			names = append(names, pair[2:])
+		}
+		for _, name := range names {
+			textObjectTable["i"+name] = func(count int) (text_range, bool) { return object_bracket(open, close, count, false) }
+			textObjectTable["a"+name] = func(count int) (text_range, bool) { return object_bracket(open, close, count, true) }
+		}
+	}
+}
+
+// select_text_object reads the key after "i" or "a" in VISUAL mode and
+// selects that object. When the selection already covers it, the next
+// object out is selected instead, so repeating i( grows the selection one
+// level of brackets at a time.
+func select_text_object(prefix string, count int) {
+	name := prefix + key_name(get_pending_key())
+	objectFunc, found := textObjectTable[name]
+	if !found {
+		return
+	}
+	start, end := position(selectionStart), position(selectionEnd)
+	if is_before(end, start) {
+		start, end = end, start
+	}
+	single := start == end
+	end, _ = next_position(end)
+	for level := max(count, 1); level < max(count, 1)+100; level++ {
+		r, ok := objectFunc(level)
+		if !ok {
+			return
+		}
+		if r.linewise {
+			r.start.col, r.end.col = 0, len(text_buffer[r.end.row])
+		}
+		if single || is_before(r.start, start) || is_before(end, r.end) {
+			last := r.end
+			if r.end != r.start {
+				last, _ = prev_position(r.end)
+			}
+			select_range(r.start.row, r.start.col, last.row, last.col)
+			if r.linewise {
+				visualKind = "V"
+			}
+			return
+		}
+	}
+}
+
+// object_word implements iw/aw: count runs of word characters, punctuation
+// or blanks starting with the one under the cursor, where aw also takes the
+// blanks after each word, or those before it at the end of a line.
+func object_word(count int, around bool, bigWord bool) (text_range, bool) {
+	line := text_buffer[currentRow]
+	if len(line) == 0 {
+		return text_range{}, false
+	}
+	classAt := func(col int) int { return word_class(line[col], bigWord) }
+	runEnd := func(col int) int {
+		class := classAt(col)
+		for col < len(line) && classAt(col) == class {
+			col = grapheme_end(line, col)
+		}
+		return col
+	}
+
+	start := min(currentCol, len(line)-1)
+	class := classAt(start)
+	for start > 0 && classAt(prev_grapheme(line, start)) == class {
+		start = prev_grapheme(line, start)
+	}
+	end := start
+	for i := 0; i < max(count, 1) && end < len(line); i++ {
+		startedOnBlank := classAt(end) == 0
+		end = runEnd(end)
+		if around && end < len(line) && (startedOnBlank || classAt(end) == 0) {
+			end = runEnd(end)
+		}
+	}
+	// Without blanks after the word aw takes the ones in front of it instead
+	if around && class != 0 && (end == len(line) || classAt(prev_grapheme(line, end)) != 0) {
+		for start > 0 && classAt(prev_grapheme(line, start)) == 0 {
+			start = prev_grapheme(line, start)
+		}
+	}
+	return text_range{position{currentRow, start}, position{currentRow, end}, false}, true
+}
+
+// object_quote implements i"/a" and the other quotes: the quoted string on
+// the cursor line around or after the cursor. Quotes escaped with a
+// backslash are skipped and a" also takes the blanks after the string.
+func object_quote(quote rune, around bool) (text_range, bool) {
+	line := text_buffer[currentRow]
+	quotes := []int{}
+	for col := 0; col < len(line); col++ {
+		if line[col] == '\\' {
+			col++
+		} else if line[col] == quote {
+			quotes = append(quotes, col)
+		}
+	}
+	for i := 0; i+1 < len(quotes); i += 2 {
+		open, close := quotes[i], quotes[i+1]
+		if close < currentCol {
+			continue
+		}
+		if !around {
+			return text_range{position{currentRow, open + 1}, position{currentRow, close}, false}, true
+		}
+		start, end := open, close+1
+		for end < len(line) && (line[end] == ' ' || line[end] == '\t') {
+			end++
+		}
+		if end == close+1 {
+			for start > 0 && (line[start-1] == ' ' || line[start-1] == '\t') {
+				start--
+			}
+		}
+		return text_range{position{currentRow, start}, position{currentRow, end}, false}, true
+	}
+	return text_range{}, false
+}
+
+// enclosing_bracket finds the count-th unmatched open bracket before the
+// cursor, treating a cursor on either bracket of a pair as inside it.
+func enclosing_bracket(open, close rune, count int) (position, bool) {
+	p := cursor()
+	if char_at(p) == open {
+		count--
+		if count == 0 {
+			return p, true
+		}
+	}
+	depth := 0
+	for {
+		var ok bool
+		if p, ok = prev_position(p); !ok {
+			return p, false
+		}
+		switch char_at(p) {
+		case close:
+			depth++
+		case open:
+			if depth > 0 {
+				depth--
+				continue
+			}
+			count--
+			if count == 0 {
+				return p, true
+			}
+		}
+	}
+}
+
+// matching_close finds the bracket closing the open bracket at p.
+func matching_close(p position, open, close rune) (position, bool) {
+	depth := 0
+	for ok := true; ok; p, ok = next_position(p) {
+		switch char_at(p) {
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return p, true
+			}
+		}
+	}
+	return p, false
+}
+
+// object_bracket implements i( and a( and the other brackets, with count
+// picking how many levels of nesting to go out. When the brackets sit on
+// lines of their own, i( covers the whole lines between them.
+func object_bracket(open, close rune, count int, around bool) (text_range, bool) {
+	start, ok := enclosing_bracket(open, close, max(count, 1))
+	if !ok {
+		return text_range{}, false
+	}
+	end, ok := matching_close(start, open, close)
+	if !ok {
+		return text_range{}, false
+	}
+	if around {
+		end, _ = next_position(end)
+		return text_range{start, end, false}, true
+	}
+
+	start, _ = next_position(start)
+	if start.col == len(text_buffer[start.row]) && end.row > start.row && end.col == first_non_blank(end.row) {
+		if end.row-start.row > 1 {
+			return text_range{position{start.row + 1, 0}, position{end.row - 1, len(text_buffer[end.row-1])}, true}, true
+		}
+		return text_range{end, end, false}, true
+	}
+	return text_range{start, end, false}, true
+}
+
+func is_blank_line(row int) bool {
+	return first_non_blank(row) == len(text_buffer[row])
+}
+
+// object_paragraph implements ip/ap: count runs of non-blank or blank lines
+// starting with the one under the cursor, where ap also takes the blank
+// lines after each paragraph, or those before it at the end of the buffer.
+func object_paragraph(count int, around bool) (text_range, bool) {
+	last := len(text_buffer) - 1
+	runEnd := func(row int) int {
+		blank := is_blank_line(row)
+		for row < last && is_blank_line(row+1) == blank {
+			row++
+		}
+		return row
+	}
+
+	start := currentRow
+	for start > 0 && is_blank_line(start-1) == is_blank_line(currentRow) {
+		start--
+	}
+	end := start - 1
+	for i := 0; i < max(count, 1) && end < last; i++ {
+		startedOnBlank := is_blank_line(end + 1)
+		end = runEnd(end + 1)
+		if around && end < last && (startedOnBlank || is_blank_line(end+1)) {
+			end = runEnd(end + 1)
+		}
+	}
+	if around && !is_blank_line(currentRow) && !is_blank_line(end) {
+		for start > 0 && is_blank_line(start-1) {
+			start--
+		}
+	}
+	return text_range{position{start, 0}, position{end, len(text_buffer[end])}, true}, true
+}
+
+// buffer_offset and offset_position convert between positions and offsets
+// into the text of the buffer joined with '\n'.
+func buffer_offset(p position) int {
+	offset := p.col
+	for row := 0; row < p.row; row++ {
+		offset += len(text_buffer[row]) + 1
+	}
+	return offset
+}
+
+func offset_position(offset int) position {
+	row := 0
+	for row < len(text_buffer)-1 && offset > len(text_buffer[row]) {
+		offset -= len(text_buffer[row]) + 1
+		row++
+	}
+	return position{row, offset}
+}
+
+type tag_pair struct {
+	openStart, openEnd, closeStart, closeEnd int
+}
+
+// tag_pairs finds the matching HTML/XML tags in text. Self-closing tags,
+// comments and declarations are skipped, and an opening tag left unclosed
+// when an outer tag closes (such as <br> or <li>) is dropped.
+func tag_pairs(text []rune) []tag_pair {
+	type open_tag struct {
+		name       string
+		start, end int
+	}
+	stack := []open_tag{}
+	pairs := []tag_pair{}
+	for start := 0; start < len(text); start++ {
+		if text[start] != '<' {
+			continue
+		}
+		end := start + 1
+		for end < len(text) && text[end] != '>' && text[end] != '<' {
+			end++
+		}
+		if end == len(text) || text[end] != '>' {
+			continue
+		}
+		end++
+		tag := string(text[start+1 : end-1])
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.TrimPrefix(tag, "/")
+		if i := strings.IndexAny(name, " \t\n/"); i >= 0 {
+			name = name[:i]
+		}
+		if name == "" || strings.ContainsAny(name[:1], "!?") || strings.HasSuffix(tag, "/") {
+			continue
+		}
+		if !closing {
+			stack = append(stack, open_tag{name, start, end})
+			continue
+		}
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].name == name {
+				pairs = append(pairs, tag_pair{stack[i].start, stack[i].end, start, end})
+				stack = stack[:i]
+				break
+			}
+		}
+	}
+	return pairs
+}
+
+// object_tag implements it/at: the contents of the count-th innermost tag
+// pair around the cursor, or the whole element for at.
+func object_tag(count int, around bool) (text_range, bool) {
+	text := []rune{}
+	for row, line := range text_buffer {
+		if row > 0 {
+			text = append(text, '\n')
+		}
+		text = append(text, line...)
+	}
+	offset := buffer_offset(cursor())
+
+	// Inner tags close first, so the enclosing pairs come out innermost first
+	for _, pair := range tag_pairs(text) {
+		if pair.openStart > offset || offset >= pair.closeEnd {
+			continue
+		}
+		count--
+		if count > 0 {
+			continue
+		}
+		if around {
+			return text_range{offset_position(pair.openStart), offset_position(pair.closeEnd), false}, true
+		}
+		return text_range{offset_position(pair.openEnd), offset_position(pair.closeStart), false}, true
+	}
+	return text_range{}, false
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagPairs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []tag_pair
+	}{
+		{"<b>x</b>", []tag_pair{{0, 3, 4, 8}}},
+		{"<a><b></b></a>", []tag_pair{{3, 6, 6, 10}, {0, 3, 10, 14}}},
+		{`<a href="x">y</a>`, []tag_pair{{0, 12, 13, 17}}},
+		{"<p>a<br>b</p>", []tag_pair{{0, 3, 9, 13}}},
+		{"<ul><li>a</ul>", []tag_pair{{0, 4, 9, 14}}},
+		{"<a><img/></a>", []tag_pair{{0, 3, 9, 13}}},
+		{"<!-- c --><a></a>", []tag_pair{{10, 13, 13, 17}}},
+		{"<!DOCTYPE html><?xml?>", []tag_pair{}},
+		{"a < b </x>", []tag_pair{}},
+		{"<a>\n</a>", []tag_pair{{0, 3, 4, 8}}},
+	}
+	for _, test := range tests {
+		if got := tag_pairs([]rune(test.text)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("tag_pairs(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
+
+func TestTextObjects(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		lines []string
+		from  position
+		want  string
+	}{
+		{"iw", 0, []string{"foo bar baz"}, position{0, 5}, "bar"},
+		{"aw", 0, []string{"foo bar baz"}, position{0, 5}, "bar "},
+		{"aw", 0, []string{"foo bar"}, position{0, 5}, " bar"},
+		{"iw", 3, []string{"foo bar baz"}, position{0, 0}, "foo bar"},
+		{"iW", 0, []string{"a foo.bar b"}, position{0, 3}, "foo.bar"},
+		{`i"`, 0, []string{`x = "a b" y`}, position{0, 6}, "a b"},
+		{`a"`, 0, []string{`x = "a b" y`}, position{0, 6}, `"a b" `},
+		{`i"`, 0, []string{`x = "a b" y`}, position{0, 0}, "a b"},
+		{"i(", 0, []string{"f(a, (b), c)"}, position{0, 3}, "a, (b), c"},
+		{"a)", 0, []string{"f(a, (b), c)"}, position{0, 6}, "(b)"},
+		{"ib", 2, []string{"f(a, (b), c)"}, position{0, 6}, "a, (b), c"},
+		{"iB", 0, []string{"if x {", "  y", "}"}, position{1, 2}, "  y"},
+		{"ip", 0, []string{"a", "b", "", "c"}, position{0, 0}, "a\nb"},
+		{"ap", 0, []string{"a", "b", "", "c"}, position{0, 0}, "a\nb\n"},
+		{"it", 0, []string{"<p><b>x</b> y</p>"}, position{0, 7}, "x"},
+		{"at", 2, []string{"<p><b>x</b> y</p>"}, position{0, 7}, "<p><b>x</b> y</p>"},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		currentRow, currentCol = test.from.row, test.from.col
+		r, ok := textObjectTable[test.name](test.count)
+		if got := string(range_text(r)); !ok || got != test.want {
+			t.Errorf("%d%s at %v in %q = %q (%v), want %q", test.count, test.name, test.from, test.lines, got, ok, test.want)
+		}
+	}
+}
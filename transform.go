@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// toggle_case_chars implements ~ in NORMAL mode: it toggles the case of
+// count characters from the cursor and moves past them.
+func toggle_case_chars(count int) {
+	line := text_buffer[currentRow]
+	if len(line) == 0 {
+		return
+	}
+	end := currentCol
+	for i := 0; i < max(count, 1) && end < len(line); i++ {
+		end = grapheme_end(line, end)
+	}
+	push_buffer()
+	convert_spans([]row_span{{currentRow, currentCol, end}}, toggle_case)
+	line = text_buffer[currentRow]
+	currentCol = grapheme_start(line, min(end, len(line)-1))
+	modified = 0
+}
+
+// wordCases maps the key after cr to the style it converts the word under
+// the cursor to.
+var wordCases = map[string]func(words []string) string{
+	"c": func(words []string) string { return join_words(words, "", true, false) },
+	"p": func(words []string) string { return join_words(words, "", true, true) },
+	"m": func(words []string) string { return join_words(words, "", true, true) },
+	"s": func(words []string) string { return join_words(words, "_", false, false) },
+	"_": func(words []string) string { return join_words(words, "_", false, false) },
+	"k": func(words []string) string { return join_words(words, "-", false, false) },
+	"-": func(words []string) string { return join_words(words, "-", false, false) },
+	"u": func(words []string) string { return strings.ToUpper(join_words(words, "_", false, false)) },
+}
+
+// join_words joins lowercase words with sep, capitalizing every word but
+// the first one, or every word with capitalizeFirst.
+func join_words(words []string, sep string, capitalize bool, capitalizeFirst bool) string {
+	parts := make([]string, len(words))
+	for i, word := range words {
+		parts[i] = word
+		if capitalize && (i > 0 || capitalizeFirst) {
+			runes := []rune(word)
+			parts[i] = string(unicode.ToUpper(runes[0])) + string(runes[1:])
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+// split_identifier splits an identifier in any of the styles in wordCases
+// into its words, in lowercase. A run of capitals is one word, so
+// parseHTTPRequest gives parse, http and request.
+func split_identifier(identifier []rune) []string {
+	words := []string{}
+	word := []rune{}
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = []rune{}
+		}
+	}
+	for i, r := range identifier {
+		switch {
+		case r == '_' || r == '-':
+			flush()
+			continue
+		case unicode.IsUpper(r) && i > 0:
+			previous := identifier[i-1]
+			nextIsLower := i+1 < len(identifier) && unicode.IsLower(identifier[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || unicode.IsUpper(previous) && nextIsLower {
+				flush()
+			}
+		}
+		word = append(word, r)
+	}
+	flush()
+	return words
+}
+
+// coerce_word implements cr followed by a key from wordCases, converting
+// the identifier under the cursor, such as crs for snake_case.
+func coerce_word() {
+	convert, found := wordCases[key_name(get_pending_key())]
+	line := text_buffer[currentRow]
+	isPart := func(col int) bool { return col < len(line) && (is_word_char(line[col]) || line[col] == '-') }
+	if !found || !isPart(currentCol) {
+		return
+	}
+	start, end := currentCol, currentCol
+	for start > 0 && isPart(start-1) {
+		start--
+	}
+	for isPart(end) {
+		end++
+	}
+	words := split_identifier(line[start:end])
+	if len(words) == 0 {
+		return
+	}
+	converted := []rune(convert(words))
+	push_buffer()
+	text_buffer[currentRow] = append(append(append([]rune{}, line[:start]...), converted...), line[end:]...)
+	currentCol = start
+	modified = 0
+}
+
+// incrementPattern finds what Ctrl+A and Ctrl+X change: dates, hexadecimal
+// and binary numbers and decimal numbers with an optional minus sign.
+var incrementPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}|0[xX][0-9a-fA-F]+|0[bB][01]+|-?\d+`)
+
+// increment_number implements Ctrl+A (delta > 0) and Ctrl+X: it adds delta
+// to the number under or after the cursor on the line, keeping its base,
+// width and the case of hex digits. In a date the year, month or day under
+// the cursor changes, the day when the cursor is before the date.
+func increment_number(delta int) {
+	line := string(text_buffer[currentRow])
+	// The cursor may sit just past the end of the line
+	cursorByte := len(string(text_buffer[currentRow][:max(min(currentCol, len(text_buffer[currentRow])-1), 0)]))
+	for _, match := range incrementPattern.FindAllStringIndex(line, -1) {
+		if match[1] <= cursorByte {
+			continue
+		}
+		text := line[match[0]:match[1]]
+		var replacement string
+		var ok bool
+		switch {
+		case len(text) == 10 && text[4] == '-':
+			replacement, ok = increment_date(text, cursorByte-match[0], delta)
+		case len(text) > 2 && (text[1] == 'x' || text[1] == 'X'):
+			replacement, ok = increment_base(text, 16, delta)
+		case len(text) > 2 && (text[1] == 'b' || text[1] == 'B'):
+			replacement, ok = increment_base(text, 2, delta)
+		default:
+			replacement, ok = increment_decimal(text, delta)
+		}
+		if !ok {
+			return
+		}
+		push_buffer()
+		start := len([]rune(line[:match[0]]))
+		updated := line[:match[0]] + replacement + line[match[1]:]
+		text_buffer[currentRow] = []rune(updated)
+		currentCol = start + len([]rune(replacement)) - 1
+		modified = 0
+		return
+	}
+}
+
+// increment_decimal adds delta to a decimal number, keeping leading zeros
+// as padding.
+func increment_decimal(text string, delta int) (string, bool) {
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return "", false
+	}
+	value += int64(delta)
+	digits := strings.TrimPrefix(text, "-")
+	if len(digits) > 1 && digits[0] == '0' {
+		sign := ""
+		if value < 0 {
+			sign, value = "-", -value
+		}
+		return fmt.Sprintf("%s%0*d", sign, len(digits), value), true
+	}
+	return strconv.FormatInt(value, 10), true
+}
+
+// increment_base adds delta to a hexadecimal or binary number written with
+// its 0x or 0b prefix, keeping its width and the case of its digits.
+func increment_base(text string, base int, delta int) (string, bool) {
+	digits := text[2:]
+	value, err := strconv.ParseUint(digits, base, 64)
+	if err != nil {
+		return "", false
+	}
+	value += uint64(int64(delta))
+	formatted := strconv.FormatUint(value, base)
+	if len(formatted) < len(digits) {
+		formatted = strings.Repeat("0", len(digits)-len(formatted)) + formatted
+	}
+	if strings.ToUpper(digits) == digits && strings.ToLower(digits) != digits {
+		formatted = strings.ToUpper(formatted)
+	}
+	return text[:2] + formatted, true
+}
+
+// increment_date adds delta years, months or days to a YYYY-MM-DD date,
+// going by the part at offset. A day past the end of the new month is
+// moved back to its last day.
+func increment_date(text string, offset int, delta int) (string, bool) {
+	date, err := time.Parse("2006-01-02", text)
+	if err != nil {
+		return "", false
+	}
+	switch {
+	case offset >= 0 && offset < 4:
+		date = add_months(date, 12*delta)
+	case offset >= 5 && offset < 7:
+		date = add_months(date, delta)
+	default:
+		date = date.AddDate(0, 0, delta)
+	}
+	return date.Format("2006-01-02"), true
+}
+
+func add_months(date time.Time, months int) time.Time {
+	first := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, months, 0)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(date.Day(), lastDay)-1)
+}
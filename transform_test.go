@@ -0,0 +1,177 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIncrementDecimal(t *testing.T) {
+	tests := []struct {
+		text  string
+		delta int
+		want  string
+	}{
+		{"7", 1, "8"},
+		{"9", 1, "10"},
+		{"0", -1, "-1"},
+		{"-1", 2, "1"},
+		{"-10", 5, "-5"},
+		{"007", 1, "008"},
+		{"009", 1, "010"},
+		{"001", -2, "-001"},
+		{"999", 1, "1000"},
+	}
+	for _, test := range tests {
+		if got, ok := increment_decimal(test.text, test.delta); !ok || got != test.want {
+			t.Errorf("increment_decimal(%q, %d) = %q, %v, want %q", test.text, test.delta, got, ok, test.want)
+		}
+	}
+}
+
+func TestIncrementBase(t *testing.T) {
+	tests := []struct {
+		text  string
+		base  int
+		delta int
+		want  string
+	}{
+		{"0x9", 16, 1, "0xa"},
+		{"0xff", 16, 1, "0x100"},
+		{"0x00ff", 16, 1, "0x0100"},
+		{"0xFF", 16, 1, "0x100"},
+		{"0xFE", 16, 1, "0xFF"},
+		{"0x101", 16, -2, "0x0ff"},
+		{"0X0a", 16, 5, "0X0f"},
+		{"0b0111", 2, 1, "0b1000"},
+		{"0b1", 2, -1, "0b0"},
+	}
+	for _, test := range tests {
+		if got, ok := increment_base(test.text, test.base, test.delta); !ok || got != test.want {
+			t.Errorf("increment_base(%q, %d, %d) = %q, %v, want %q", test.text, test.base, test.delta, got, ok, test.want)
+		}
+	}
+}
+
+func TestIncrementDate(t *testing.T) {
+	tests := []struct {
+		text   string
+		offset int
+		delta  int
+		want   string
+	}{
+		{"2024-01-31", 9, 1, "2024-02-01"},
+		{"2024-01-31", -3, 1, "2024-02-01"},
+		{"2024-03-01", 8, -1, "2024-02-29"},
+		{"2024-01-31", 5, 1, "2024-02-29"},
+		{"2023-01-31", 6, 1, "2023-02-28"},
+		{"2024-12-15", 5, 1, "2025-01-15"},
+		{"2024-02-29", 0, 1, "2025-02-28"},
+		{"2024-05-10", 3, -4, "2020-05-10"},
+	}
+	for _, test := range tests {
+		if got, ok := increment_date(test.text, test.offset, test.delta); !ok || got != test.want {
+			t.Errorf("increment_date(%q, %d, %d) = %q, %v, want %q", test.text, test.offset, test.delta, got, ok, test.want)
+		}
+	}
+	if _, ok := increment_date("2024-13-01", 9, 1); ok {
+		t.Errorf("increment_date accepted month 13")
+	}
+}
+
+func TestIncrementNumber(t *testing.T) {
+	tests := []struct {
+		line  string
+		col   int
+		delta int
+		want  string
+	}{
+		{"x = 41;", 0, 1, "x = 42;"},
+		{"x = 41;", 5, 1, "x = 42;"},
+		{"a1 b2", 2, 10, "a1 b12"},
+		{"x-1", 0, 1, "x0"},
+		{"no numbers", 0, 1, "no numbers"},
+		{"v 9", 3, 1, "v 10"},
+	}
+	for _, test := range tests {
+		set_buffer(test.line)
+		currentCol = test.col
+		increment_number(test.delta)
+		if got := string(text_buffer[0]); got != test.want {
+			t.Errorf("increment_number on %q at %d = %q, want %q", test.line, test.col, got, test.want)
+		}
+	}
+}
+
+func TestSplitIdentifier(t *testing.T) {
+	tests := []struct {
+		identifier string
+		want       []string
+	}{
+		{"fooBar", []string{"foo", "bar"}},
+		{"FooBar", []string{"foo", "bar"}},
+		{"foo_bar", []string{"foo", "bar"}},
+		{"foo-bar", []string{"foo", "bar"}},
+		{"FOO_BAR", []string{"foo", "bar"}},
+		{"parseHTTPRequest", []string{"parse", "http", "request"}},
+		{"HTTPServer", []string{"http", "server"}},
+		{"utf8Decode", []string{"utf8", "decode"}},
+		{"__init__", []string{"init"}},
+		{"x", []string{"x"}},
+	}
+	for _, test := range tests {
+		if got := split_identifier([]rune(test.identifier)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("split_identifier(%q) = %q, want %q", test.identifier, got, test.want)
+		}
+	}
+}
+
+func TestWordCases(t *testing.T) {
+	words := []string{"parse", "http", "request"}
+	tests := map[string]string{
+		"c": "parseHttpRequest",
+		"p": "ParseHttpRequest",
+		"s": "parse_http_request",
+		"k": "parse-http-request",
+		"u": "PARSE_HTTP_REQUEST",
+	}
+	for key, want := range tests {
+		if got := wordCases[key](words); got != want {
+			t.Errorf("cr%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestTransformKeys(t *testing.T) {
+	tests := []struct {
+		line string
+		keys string
+		want string
+	}{
+		{"abc", "~", "Abc"},
+		{"abc", "2~", "ABc"},
+		{"abc", "~.", "ABc"},
+		{"abc def", "g~w", "ABC def"},
+		{"abc def", "g~~", "ABC DEF"},
+		{"x = 41", "\x01", "x = 42"},
+		{"x = 41", "5\x01", "x = 46"},
+		{"x = 41", "\x18", "x = 40"},
+		{"x = 41", "\x01.", "x = 43"},
+		{"x = 41", "\x013.", "x = 45"},
+		{"0x0f", "\x01", "0x10"},
+		{"2024-01-31", "8l\x01", "2024-02-01"},
+		{"fooBar", "crs", "foo_bar"},
+		{"foo_bar", "crc", "fooBar"},
+		{"foo_bar", "crp", "FooBar"},
+		{"foo_bar baz", "crk", "foo-bar baz"},
+		{"fooBar", "cru", "FOO_BAR"},
+		{"foo_bar", "crcu", "foo_bar"},
+	}
+	for _, test := range tests {
+		set_buffer(test.line)
+		lastChange = nil
+		run_keys(t, test.keys)
+		if got := string(text_buffer[0]); got != test.want {
+			t.Errorf("%q on %q = %q, want %q", test.keys, test.line, got, test.want)
+		}
+	}
+}
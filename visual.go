@@ -0,0 +1,462 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// row_span is the columns [start, end) of one row of text_buffer.
+type row_span struct {
+	row, start, end int
+}
+
+var (
+	// visualKind is the key that started VISUAL mode: "v" selects
+	// characters, "V" whole lines and "<C-v>" a block of columns.
+	visualKind = "v"
+	// lastVisual is the selection gv brings back.
+	lastVisual struct {
+		kind       string
+		start, end position
+		saved      bool
+	}
+	// blockInsert follows text typed with I, A or c on a block so it can be
+	// repeated on the other rows of the block when INSERT mode ends.
+	blockInsert struct {
+		active      bool
+		top, bottom int
+		vcol        int
+		appending   bool
+		col, length int
+		lines       int
+	}
+)
+
+// caseConversions maps the keys that change case in VISUAL mode to the
+// conversion they apply.
+var caseConversions = map[string]func(rune) rune{
+	"u":  unicode.ToLower,
+	"U":  unicode.ToUpper,
+	"gu": unicode.ToLower,
+	"gU": unicode.ToUpper,
+	"~":  toggle_case,
+	"g~": toggle_case,
+}
+
+func toggle_case(r rune) rune {
+	if unicode.IsUpper(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
+
+// start_visual enters VISUAL mode of the given kind with the selection
+// starting at the cursor, or switches kind if VISUAL mode is already on.
+// Pressing the key of the current kind again leaves VISUAL mode.
+func start_visual(kind string) {
+	if mode == 4 {
+		if kind == visualKind {
+			end_visual()
+			return
+		}
+		visualKind = kind
+		return
+	}
+	mode = 4
+	visualKind = kind
+	selectionStart.row, selectionStart.col = currentRow, currentCol
+	selectionEnd.row, selectionEnd.col = currentRow, currentCol
+}
+
+// end_visual leaves VISUAL mode, remembering the selection for gv.
+func end_visual() {
+	if mode != 4 {
+		return
+	}
+	lastVisual.kind = visualKind
+	lastVisual.start = position(selectionStart)
+	lastVisual.end = position(selectionEnd)
+	lastVisual.saved = true
+	mode = 0
+}
+
+// reselect_visual implements gv.
+func reselect_visual() {
+	if !lastVisual.saved {
+		return
+	}
+	clamp := func(p position) position {
+		p.row = max(min(p.row, len(text_buffer)-1), 0)
+		p.col = min(p.col, len(text_buffer[p.row]))
+		return p
+	}
+	start, end := clamp(lastVisual.start), clamp(lastVisual.end)
+	mode = 4
+	visualKind = lastVisual.kind
+	selectionStart.row, selectionStart.col = start.row, start.col
+	selectionEnd.row, selectionEnd.col = end.row, end.col
+	currentRow, currentCol = end.row, end.col
+}
+
+// swap_selection_ends implements o, moving the cursor to the other end of
+// the selection.
+func swap_selection_ends() {
+	selectionStart, selectionEnd = selectionEnd, selectionStart
+	currentRow, currentCol = selectionEnd.row, selectionEnd.col
+}
+
+// visual_range returns the selection as a range for the operators, which
+// for a block covers the lines it is on.
+func visual_range() text_range {
+	start, end := position(selectionStart), position(selectionEnd)
+	if is_before(end, start) {
+		start, end = end, start
+	}
+	if visualKind != "v" {
+		return text_range{position{start.row, 0}, position{end.row, len(text_buffer[end.row])}, true}
+	}
+	if end.col < len(text_buffer[end.row]) {
+		end.col = grapheme_end(text_buffer[end.row], end.col)
+	} else {
+		end, _ = next_position(end)
+	}
+	return text_range{start, end, false}
+}
+
+// visual_block returns the rows and the screen columns, inclusive, of a
+// block selection. A wide character at either corner widens the block to
+// cover all of it.
+func visual_block() (top, bottom, left, right int) {
+	top, bottom = min(selectionStart.row, selectionEnd.row), max(selectionStart.row, selectionEnd.row)
+	startLine, endLine := text_buffer[selectionStart.row], text_buffer[selectionEnd.row]
+	startVcol, endVcol := visual_col(startLine, selectionStart.col), visual_col(endLine, selectionEnd.col)
+	left = min(startVcol, endVcol)
+	right = max(startVcol+cursor_width(startLine, selectionStart.col), endVcol+cursor_width(endLine, selectionEnd.col)) - 1
+	return top, bottom, left, right
+}
+
+// block_span returns the characters of row that fall at least partly in
+// the screen columns left to right.
+func block_span(row, left, right int) row_span {
+	line := text_buffer[row]
+	start := col_from_visual(line, left)
+	end := start
+	for end < len(line) && visual_col(line, end) <= right {
+		end = grapheme_end(line, end)
+	}
+	return row_span{row, start, end}
+}
+
+// selection_spans returns the selected columns of every selected row.
+func selection_spans() []row_span {
+	if visualKind == "<C-v>" {
+		top, bottom, left, right := visual_block()
+		spans := []row_span{}
+		for row := top; row <= bottom; row++ {
+			spans = append(spans, block_span(row, left, right))
+		}
+		return spans
+	}
+	return range_spans(visual_range())
+}
+
+// range_spans splits r into the columns it covers on each row.
+func range_spans(r text_range) []row_span {
+	if r.linewise {
+		r.start.col, r.end.col = 0, len(text_buffer[r.end.row])
+	}
+	spans := []row_span{}
+	for row := r.start.row; row <= r.end.row; row++ {
+		span := row_span{row, 0, len(text_buffer[row])}
+		if row == r.start.row {
+			span.start = r.start.col
+		}
+		if row == r.end.row {
+			span.end = r.end.col
+		}
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// convert_spans maps every character in spans through convert.
+func convert_spans(spans []row_span, convert func(rune) rune) {
+	for _, span := range spans {
+		line := append([]rune{}, text_buffer[span.row]...)
+		for col := span.start; col < span.end; col++ {
+			line[col] = convert(line[col])
+		}
+		text_buffer[span.row] = line
+	}
+}
+
+// visual_operator leaves VISUAL mode and applies the command name to what
+// was selected.
+func visual_operator(name string, count int) {
+	end_visual()
+	if visualKind == "<C-v>" {
+		block_operator(name, count)
+	} else if name == ">" || name == "<" {
+		operator_shift(visual_range(), shift_levels(name, count))
+	} else if convert, found := caseConversions[name]; found {
+		operator_case(visual_range(), convert)
+	} else if operator, found := operatorTable[name]; found {
+		operator(visual_range())
+	}
+}
+
+// shift_levels is how many levels > or < with count shifts by, negative
+// for outdenting.
+func shift_levels(name string, count int) int {
+	if name == "<" {
+		return -max(count, 1)
+	}
+	return max(count, 1)
+}
+
+// block_operator is visual_operator for a block selection.
+func block_operator(name string, count int) {
+	top, bottom, left, right := visual_block()
+	spans := selection_spans()
+	switch name {
+	case "d", "c", "y":
+		text := []rune{}
+		for i, span := range spans {
+			if i > 0 {
+				text = append(text, '\n')
+			}
+			text = append(text, text_buffer[span.row][span.start:span.end]...)
+		}
+		currentRow, currentCol = top, spans[0].start
+		if name == "y" {
+			set_register(text, false, false)
+			return
+		}
+		push_buffer()
+		set_register(text, false, true)
+		for _, span := range spans {
+			line := text_buffer[span.row]
+			text_buffer[span.row] = append(line[:span.start:span.start], line[span.end:]...)
+		}
+		modified = 0
+		if name == "c" {
+			start_block_insert(top, bottom, left, false)
+		}
+	case ">", "<":
+		operator_shift(text_range{position{top, 0}, position{bottom, len(text_buffer[bottom])}, true}, shift_levels(name, count))
+	case "=", "gc":
+		operatorTable[name](text_range{position{top, 0}, position{bottom, len(text_buffer[bottom])}, true})
+	case "u", "U", "gu", "gU", "~", "g~":
+		push_buffer()
+		convert_spans(spans, caseConversions[name])
+		currentRow, currentCol = top, spans[0].start
+		modified = 0
+	case "I":
+		currentRow, currentCol = top, col_from_visual(text_buffer[top], left)
+		start_block_insert(top, bottom, left, false)
+	case "A":
+		push_buffer()
+		pad_line(top, right+1)
+		currentRow, currentCol = top, col_from_visual(text_buffer[top], right+1)
+		start_block_insert(top, bottom, right+1, true)
+	}
+}
+
+// pad_line adds spaces to the end of row until it is vcol columns wide.
+func pad_line(row, vcol int) {
+	line := text_buffer[row]
+	if width := visual_col(line, len(line)); width < vcol {
+		text_buffer[row] = append(append([]rune{}, line...), []rune(strings.Repeat(" ", vcol-width))...)
+	}
+}
+
+// replace_selection implements r in VISUAL mode, reading a character and
+// putting it in place of every selected one.
+func replace_selection() {
+	ch := key_char(get_pending_key())
+	end_visual()
+	if ch == 0 {
+		return
+	}
+	push_buffer()
+	spans := selection_spans()
+	for _, span := range spans {
+		line := text_buffer[span.row]
+		replaced := append([]rune{}, line[:span.start]...)
+		for col := span.start; col < span.end; col = grapheme_end(line, col) {
+			replaced = append(replaced, ch)
+		}
+		text_buffer[span.row] = append(replaced, line[span.end:]...)
+	}
+	currentRow, currentCol = spans[0].row, spans[0].start
+	modified = 0
+}
+
+// start_block_insert enters INSERT mode at the cursor on the top row of a
+// block so that finish_block_insert can copy what is typed to the rows
+// below.
+func start_block_insert(top, bottom, vcol int, appending bool) {
+	blockInsert.active = true
+	blockInsert.top, blockInsert.bottom = top, bottom
+	blockInsert.vcol, blockInsert.appending = vcol, appending
+	blockInsert.col, blockInsert.length = currentCol, len(text_buffer[top])
+	blockInsert.lines = len(text_buffer)
+	mode = 1
+}
+
+// finish_block_insert inserts the text typed on the top row of a block at
+// the same screen column on the other rows when INSERT mode ends. Rows too
+// short to reach the block are skipped by I and padded by A. Typing a line
+// break or moving off the row types on that row alone. The text repeated is
+// what the row grew by from the block column, so it includes closing
+// characters that autopairs typed after the cursor.
+func finish_block_insert() {
+	if !blockInsert.active {
+		return
+	}
+	blockInsert.active = false
+	line := text_buffer[blockInsert.top]
+	inserted := len(line) - blockInsert.length
+	if currentRow != blockInsert.top || len(text_buffer) != blockInsert.lines || inserted <= 0 ||
+		currentCol < blockInsert.col || currentCol > blockInsert.col+inserted {
+		return
+	}
+	text := line[blockInsert.col : blockInsert.col+inserted]
+
+	push_buffer()
+	for row := blockInsert.top + 1; row <= blockInsert.bottom; row++ {
+		if visual_col(text_buffer[row], len(text_buffer[row])) < blockInsert.vcol {
+			if !blockInsert.appending {
+				continue
+			}
+			pad_line(row, blockInsert.vcol)
+		}
+		rowLine := text_buffer[row]
+		col := col_from_visual(rowLine, blockInsert.vcol)
+		joined := append(append(append([]rune{}, rowLine[:col]...), text...), rowLine[col:]...)
+		text_buffer[row] = joined
+	}
+}
+
+// surroundPairs maps the characters that surround a selection as one half
+// of a pair to the other half.
+var surroundPairs = map[rune][2]rune{
+	'(': {'(', ')'}, ')': {'(', ')'},
+	'[': {'[', ']'}, ']': {'[', ']'},
+	'{': {'{', '}'}, '}': {'{', '}'},
+	'<': {'<', '>'}, '>': {'<', '>'},
+}
+
+// delete_selection removes the selection for p and S, keeping a copy of it
+// in the unnamed register, and returns where it started. Callers are
+// responsible for push_buffer.
+func delete_selection() position {
+	selected := selectedRegister
+	selectedRegister = 0
+	defer func() { selectedRegister = selected }()
+
+	if visualKind == "<C-v>" {
+		spans := selection_spans()
+		text := []rune{}
+		for i, span := range spans {
+			if i > 0 {
+				text = append(text, '\n')
+			}
+			text = append(text, text_buffer[span.row][span.start:span.end]...)
+			line := text_buffer[span.row]
+			text_buffer[span.row] = append(line[:span.start:span.start], line[span.end:]...)
+		}
+		set_register(text, false, true)
+		return position{spans[0].row, spans[0].start}
+	}
+	r := visual_range()
+	set_register(range_text(r), r.linewise, true)
+	delete_range(r)
+	return r.start
+}
+
+// paste_over_selection implements p in VISUAL mode, putting a register in
+// place of the selection as a single change. The replaced text goes to the
+// unnamed register.
+func paste_over_selection(count int) {
+	value := get_register(selectedRegister)
+	end_visual()
+	if len(value.text) == 0 && !value.linewise {
+		return
+	}
+	text := []rune{}
+	for i := 0; i < max(count, 1); i++ {
+		if i > 0 && value.linewise {
+			text = append(text, '\n')
+		}
+		text = append(text, value.text...)
+	}
+
+	push_buffer()
+	linewise := visualKind == "V"
+	whole := linewise && visual_range().start.row == 0 && visual_range().end.row == len(text_buffer)-1
+	start := delete_selection()
+	switch {
+	case linewise:
+		// The selected lines are gone, so the text goes in as lines of its own
+		insert_lines(start.row, split_lines(text))
+		start = position{start.row, first_non_blank(start.row)}
+	case value.linewise:
+		text = append(append([]rune{'\n'}, text...), '\n')
+		insert_text(start, text)
+		start = position{start.row + 1, first_non_blank(start.row + 1)}
+	default:
+		end := insert_text(start, text)
+		start, _ = prev_position(end)
+	}
+	if whole {
+		// Deleting every line left an empty one behind the new text
+		delete_lines(len(text_buffer)-1, len(text_buffer)-1)
+	}
+	currentRow, currentCol = start.row, start.col
+	modified = 0
+}
+
+// surround_selection implements S in VISUAL mode, reading a character and
+// putting it before and after the selection, or the two halves of a pair
+// of brackets. Whole lines are surrounded by lines of their own and each
+// row of a block is surrounded separately.
+func surround_selection() {
+	ch := key_char(get_pending_key())
+	end_visual()
+	if ch == 0 || ch == '\t' {
+		return
+	}
+	open, close := ch, ch
+	if pair, found := surroundPairs[ch]; found {
+		open, close = pair[0], pair[1]
+	}
+
+	push_buffer()
+	switch visualKind {
+	case "<C-v>":
+		for _, span := range selection_spans() {
+			line := text_buffer[span.row]
+			surrounded := append(append([]rune{}, line[:span.start]...), open)
+			surrounded = append(append(surrounded, line[span.start:span.end]...), close)
+			text_buffer[span.row] = append(surrounded, line[span.end:]...)
+		}
+	case "V":
+		r := visual_range()
+		indent := text_buffer[r.start.row][:first_non_blank(r.start.row)]
+		insert_lines(r.end.row+1, [][]rune{append(append([]rune{}, indent...), close)})
+		insert_lines(r.start.row, [][]rune{append(append([]rune{}, indent...), open)})
+		for row := r.start.row + 1; row <= r.end.row+1; row++ {
+			if len(text_buffer[row]) > 0 {
+				shift_line(row, 1)
+			}
+		}
+	default:
+		r := visual_range()
+		insert_text(r.end, []rune{close})
+		insert_text(r.start, []rune{open})
+	}
+	start := visual_range().start
+	currentRow, currentCol = start.row, start.col
+	modified = 0
+}
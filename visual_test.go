@@ -0,0 +1,141 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVisualOperators(t *testing.T) {
+	keep_options(t)
+	options.tabWidth, options.expandTab = 4, true
+	tests := []struct {
+		lines []string
+		keys  string
+		want  []string
+	}{
+		{[]string{"one two three"}, "wvlld", []string{"one  three"}},
+		{[]string{"one", "two", "three"}, "lvjd", []string{"oo", "three"}},
+		{[]string{"one", "two", "three"}, "jVd", []string{"one", "three"}},
+		{[]string{"one", "two", "three"}, "Vjd", []string{"three"}},
+		{[]string{"one two"}, "veU", []string{"ONE two"}},
+		{[]string{"One Two"}, "V~", []string{"oNE tWO"}},
+		{[]string{"ONE TWO"}, "wvEu", []string{"ONE two"}},
+		{[]string{"one two"}, "velrx", []string{"xxxxtwo"}},
+		{[]string{"one two"}, "wvecX\x1b", []string{"one X"}},
+		{[]string{"one two three"}, "wviwd", []string{"one  three"}},
+		{[]string{"f(a, (b))"}, "fbvi(a(d", []string{"f(a, )"}},
+		{[]string{"a", "b"}, "Vj>", []string{"    a", "    b"}},
+		{[]string{"one two"}, "wveohd", []string{"one"}},
+		{[]string{"one two"}, "ve\x1bwgvd", []string{" two"}},
+		{[]string{"abcd", "efgh", "ijkl"}, "l\x16jld", []string{"ad", "eh", "ijkl"}},
+		{[]string{"abcd", "efgh"}, "l\x16jlU", []string{"aBCd", "eFGh"}},
+		{[]string{"abcd", "efgh"}, "l\x16jlrx", []string{"axxd", "exxh"}},
+		{[]string{"abcd", "e", "ijkl"}, "ll\x16jjIXY\x1b", []string{"abXYcd", "e", "ijXYkl"}},
+		{[]string{"abcd", "e", "ijkl"}, "l\x16jjlAXY\x1b", []string{"abcXYd", "e  XY", "ijkXYl"}},
+		{[]string{"abcd", "efgh"}, "l\x16jlcX\x1b", []string{"aXd", "eXh"}},
+		{[]string{"abcd", "efgh"}, "l\x16jIX\r\x1b", []string{"aX", "bcd", "efgh"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q on %q = %q, want %q", test.keys, test.lines, got, test.want)
+		}
+		if mode != 0 {
+			t.Errorf("%q left mode %d", test.keys, mode)
+			mode = 0
+		}
+	}
+}
+
+func TestRepeatVisualChange(t *testing.T) {
+	keep_options(t)
+	options.tabWidth, options.expandTab = 4, true
+	tests := []struct {
+		lines []string
+		keys  string
+		want  []string
+	}{
+		{[]string{"a", "b", "c", "d"}, "Vj>jj.", []string{"    a", "    b", "    c", "    d"}},
+		{[]string{"a", "b", "c"}, "Vd.", []string{"c"}},
+		{[]string{"one two three"}, "veUww.", []string{"ONE two THRee"}},
+		{[]string{"ab", "cd", "ef", "gh"}, "vjdj.", []string{"d", "h"}},
+		{[]string{"abc", "def", "ghi", "jkl"}, "\x16jlrxjj0.", []string{"xxc", "xxf", "xxi", "xxl"}},
+		{[]string{"abc", "def", "ghi", "jkl"}, "\x16jIX\x1bjj0.", []string{"Xabc", "Xdef", "Xghi", "Xjkl"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		lastChange = nil
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q on %q = %q, want %q", test.keys, test.lines, got, test.want)
+		}
+	}
+}
+
+func TestRepeatAfterVisualMotion(t *testing.T) {
+	set_buffer("a b c d")
+	lastChange = nil
+	run_keys(t, "dwvlh\x1b.")
+	if got := buffer_lines(); !reflect.DeepEqual(got, []string{"c d"}) {
+		t.Errorf(". after selecting without a change = %q", got)
+	}
+}
+
+func TestPasteOverSelection(t *testing.T) {
+	tests := []struct {
+		lines []string
+		keys  string
+		want  []string
+	}{
+		{[]string{"one two"}, `"ayewve"ap`, []string{"one one"}},
+		{[]string{"one two"}, `"ayewve2"ap`, []string{"one oneone"}},
+		{[]string{"one", "two", "three"}, `"ayyjV"ap`, []string{"one", "one", "three"}},
+		{[]string{"one", "two", "three"}, `"ayyjVj"ap`, []string{"one", "one"}},
+		{[]string{"one", "two"}, `"ayyVj"ap`, []string{"one"}},
+		{[]string{"one", "two x"}, `"ayyjwv"ap`, []string{"one", "two ", "one", ""}},
+		{[]string{"one two"}, `"ayewve"apbvep`, []string{"one two"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		registers = map[rune]register{}
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s on %q = %q, want %q", test.keys, test.lines, got, test.want)
+		}
+	}
+}
+
+func TestVisualDeleteKeys(t *testing.T) {
+	for _, keys := range []string{"vlx", "vl\x7f", "vld"} {
+		set_buffer("abcd")
+		run_keys(t, keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, []string{"cd"}) {
+			t.Errorf("%q = %q", keys, got)
+		}
+	}
+}
+
+func TestSurroundSelection(t *testing.T) {
+	keep_options(t)
+	options.tabWidth, options.expandTab = 4, true
+	tests := []struct {
+		lines []string
+		keys  string
+		want  []string
+	}{
+		{[]string{"one two"}, `wveS"`, []string{`one "two"`}},
+		{[]string{"one two"}, "veS)", []string{"(one) two"}},
+		{[]string{"one two"}, "veS[", []string{"[one] two"}},
+		{[]string{"ab", "cd"}, "lvjS*", []string{"a*b", "cd*"}},
+		{[]string{"  a", "  b"}, "VjS{", []string{"  {", "      a", "      b", "  }"}},
+		{[]string{"abc", "def"}, "l\x16jS<", []string{"a<b>c", "d<e>f"}},
+	}
+	for _, test := range tests {
+		set_buffer(test.lines...)
+		run_keys(t, test.keys)
+		if got := buffer_lines(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q on %q = %q, want %q", test.keys, test.lines, got, test.want)
+		}
+	}
+}
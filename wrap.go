@@ -0,0 +1,216 @@
+package main
+
+import "github.com/mattn/go-runewidth"
+
+// screen_line describes what one screen row shows: the columns
+// [startCol, endCol) of text_buffer row row, clipped to the screen columns
+// [startVcol, endVcol) of that line and drawn from screen column x.
+type screen_line struct {
+	row                int
+	startCol, endCol   int
+	startVcol, endVcol int
+	x                  int
+	continuation       bool
+}
+
+func text_width() int {
+	return max(COLS-lineNumberWidth, 1)
+}
+
+// continuation_indent returns the width reserved at the start of every
+// wrapped continuation row of line for breakindent and showbreak.
+func continuation_indent(line []rune) int {
+	indent := runewidth.StringWidth(options.showBreak)
+	if options.breakIndent {
+		leading := 0
+		for leading < len(line) && (line[leading] == ' ' || line[leading] == '\t') {
+			leading++
+		}
+		indent += visual_col(line, leading)
+	}
+	// Always leave room for at least a few characters per row
+	return min(indent, text_width()/2)
+}
+
+// wrap_segments returns the column at which each screen row of line starts
+// when soft wrapping. The first entry is always 0.
+func wrap_segments(line []rune) []int {
+	segments := []int{0}
+	available := text_width()
+	indent := continuation_indent(line)
+
+	rowWidth := 0
+	lastBreak := -1 // Column just after the last blank in this row
+	vcol := 0
+	for col := 0; col < len(line); {
+		end := grapheme_end(line, col)
+		width := cluster_width(line, col, end, vcol)
+		if rowWidth+width > available && col > segments[len(segments)-1] {
+			start := col
+			if options.lineBreak && lastBreak > segments[len(segments)-1] {
+				start = lastBreak
+			}
+			segments = append(segments, start)
+			available = max(text_width()-indent, 1)
+			rowWidth = visual_col(line, col) - visual_col(line, start)
+			lastBreak = -1
+		}
+		if line[col] == ' ' || line[col] == '\t' {
+			lastBreak = end
+		}
+		rowWidth += width
+		vcol += width
+		col = end
+	}
+	return segments
+}
+
+// segment_index returns which of segments contains column col.
+func segment_index(segments []int, col int) int {
+	index := 0
+	for i, start := range segments {
+		if start <= col {
+			index = i
+		}
+	}
+	return index
+}
+
+// layout_screen works out which part of text_buffer each of the ROWS text
+// rows shows, following offsetRow/offsetCol or soft wrapping.
+func layout_screen() []screen_line {
+	screenLines := make([]screen_line, 0, ROWS)
+	if !options.wrap {
+		for row := 0; row < ROWS; row++ {
+			screenLine := screen_line{row: row + offsetRow, startVcol: offsetCol, endVcol: offsetCol + text_width(), x: lineNumberWidth}
+			if screenLine.row < len(text_buffer) {
+				screenLine.endCol = len(text_buffer[screenLine.row])
+			}
+			screenLines = append(screenLines, screenLine)
+		}
+		return screenLines
+	}
+
+	row, segment := offsetRow, offsetWrap
+	for len(screenLines) < ROWS {
+		if row >= len(text_buffer) {
+			screenLines = append(screenLines, screen_line{row: row})
+			row++
+			continue
+		}
+		line := text_buffer[row]
+		segments := wrap_segments(line)
+		for ; segment < len(segments) && len(screenLines) < ROWS; segment++ {
+			screenLine := screen_line{row: row, startCol: segments[segment], endCol: len(line), x: lineNumberWidth}
+			if segment+1 < len(segments) {
+				screenLine.endCol = segments[segment+1]
+			}
+			screenLine.startVcol = visual_col(line, screenLine.startCol)
+			screenLine.endVcol = visual_col(line, screenLine.endCol)
+			if segment > 0 {
+				screenLine.continuation = true
+				screenLine.x += continuation_indent(line)
+			}
+			screenLines = append(screenLines, screenLine)
+		}
+		row++
+		segment = 0
+	}
+	return screenLines
+}
+
+// cursor_screen_position returns where the terminal cursor goes for
+// currentRow/currentCol.
+func cursor_screen_position() (int, int) {
+	line := text_buffer[currentRow]
+	cursorCol := visual_col(line, currentCol)
+	if !options.wrap {
+		return cursorCol - offsetCol + lineNumberWidth, currentRow - offsetRow
+	}
+
+	for y, screenLine := range layout_screen() {
+		if screenLine.row != currentRow {
+			continue
+		}
+		if currentCol < screenLine.endCol || currentCol == len(line) && screenLine.endCol == len(line) {
+			return cursorCol - screenLine.startVcol + screenLine.x, y
+		}
+	}
+	return lineNumberWidth, 0
+}
+
+// scroll_wrapped is scroll_text_buffer for soft wrapping: offsetCol stays at
+// 0 and offsetRow/offsetWrap move until the cursor's screen row is visible.
+func scroll_wrapped() {
+	offsetCol = 0
+	if offsetRow >= len(text_buffer) {
+		offsetRow = len(text_buffer) - 1
+	}
+	if offsetWrap >= len(wrap_segments(text_buffer[offsetRow])) {
+		offsetWrap = 0
+	}
+
+	cursorSegment := segment_index(wrap_segments(text_buffer[currentRow]), currentCol)
+	if currentRow < offsetRow || currentRow == offsetRow && cursorSegment < offsetWrap {
+		offsetRow, offsetWrap = currentRow, cursorSegment
+		return
+	}
+
+	// Count the screen rows from the top of the screen down to the cursor and
+	// drop rows off the top until that fits
+	for {
+		rows := cursorSegment + 1 - offsetWrap
+		for row := offsetRow; row < currentRow; row++ {
+			rows += len(wrap_segments(text_buffer[row]))
+		}
+		if rows <= ROWS {
+			return
+		}
+		offsetWrap++
+		if offsetWrap >= len(wrap_segments(text_buffer[offsetRow])) {
+			offsetRow++
+			offsetWrap = 0
+		}
+	}
+}
+
+// display_rows_target returns where moving delta screen rows from the cursor
+// lands, which differs from moving delta lines only when soft wrapping.
+func display_rows_target(delta int) (int, int) {
+	if !options.wrap {
+		row := max(min(currentRow+delta, len(text_buffer)-1), 0)
+		return row, col_from_visual(text_buffer[row], preferredCol)
+	}
+
+	line := text_buffer[currentRow]
+	segments := wrap_segments(line)
+	segment := segment_index(segments, currentCol)
+	screenCol := visual_col(line, currentCol) - visual_col(line, segments[segment])
+
+	row := currentRow
+	for ; delta > 0; delta-- {
+		if segment+1 < len(segments) {
+			segment++
+		} else if row+1 < len(text_buffer) {
+			row++
+			segments = wrap_segments(text_buffer[row])
+			segment = 0
+		}
+	}
+	for ; delta < 0; delta++ {
+		if segment > 0 {
+			segment--
+		} else if row > 0 {
+			row--
+			segments = wrap_segments(text_buffer[row])
+			segment = len(segments) - 1
+		}
+	}
+
+	line = text_buffer[row]
+	col := col_from_visual(line, visual_col(line, segments[segment])+screenCol)
+	if segment+1 < len(segments) && col >= segments[segment+1] {
+		col = prev_grapheme(line, segments[segment+1])
+	}
+	return row, col
+}
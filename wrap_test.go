@@ -0,0 +1,78 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWrapSegments(t *testing.T) {
+	keep_options(t)
+	COLS, lineNumberWidth = 10, 0
+	tests := []struct {
+		line        string
+		lineBreak   bool
+		breakIndent bool
+		showBreak   string
+		want        []int
+	}{
+		{"short", false, false, "", []int{0}},
+		{"0123456789", false, false, "", []int{0}},
+		{"0123456789abcdefghijk", false, false, "", []int{0, 10, 20}},
+		{"0123456789abcdef", false, false, "> ", []int{0, 10}},
+		{"0123456789abcdefghij", false, false, "> ", []int{0, 10, 18}},
+		{"one two three four", true, false, "", []int{0, 8}},
+		{"one two three fours", true, false, "", []int{0, 8, 14}},
+		{"one two three four", false, false, "", []int{0, 10}},
+		{"  ab cd ef gh", false, true, "", []int{0, 10}},
+		{"  abcdefghijklmnopq", false, true, "", []int{0, 10, 18}},
+		{"日本語日本語", false, false, "", []int{0, 5}},
+		{"abcdefghi日本", false, false, "", []int{0, 9}},
+	}
+	for _, test := range tests {
+		options.lineBreak, options.breakIndent, options.showBreak = test.lineBreak, test.breakIndent, test.showBreak
+		if got := wrap_segments([]rune(test.line)); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("wrap_segments(%q) = %v, want %v", test.line, got, test.want)
+		}
+	}
+}
+
+func TestDisplayRowsTarget(t *testing.T) {
+	keep_options(t)
+	COLS, lineNumberWidth = 10, 0
+	options.wrap, options.lineBreak, options.showBreak = true, false, ""
+	set_buffer("0123456789abcdefghij", "xyzw")
+	currentCol = 3
+	currentRow, currentCol = display_rows_target(1)
+	if currentRow != 0 || currentCol != 13 {
+		t.Errorf("gj = %d,%d, want 0,13", currentRow, currentCol)
+	}
+	currentRow, currentCol = display_rows_target(1)
+	if currentRow != 1 || currentCol != 3 {
+		t.Errorf("second gj = %d,%d, want 1,3", currentRow, currentCol)
+	}
+	currentRow, currentCol = display_rows_target(-1)
+	if currentRow != 0 || currentCol != 13 {
+		t.Errorf("gk = %d,%d, want 0,13", currentRow, currentCol)
+	}
+}
+
+func TestScrollWrapped(t *testing.T) {
+	keep_options(t)
+	COLS, ROWS, lineNumberWidth = 10, 2, 0
+	options.wrap, options.lineBreak, options.showBreak = true, false, ""
+	set_buffer("0123456789abcdefghij", "xy")
+	offsetRow, offsetWrap = 0, 0
+	currentRow = 1
+	scroll_wrapped()
+	if offsetRow != 0 || offsetWrap != 1 {
+		t.Errorf("offset = %d,%d, want 0,1", offsetRow, offsetWrap)
+	}
+	if x, y := cursor_screen_position(); x != 0 || y != 1 {
+		t.Errorf("cursor at %d,%d, want 0,1", x, y)
+	}
+	currentRow, currentCol = 0, 2
+	scroll_wrapped()
+	if offsetRow != 0 || offsetWrap != 0 {
+		t.Errorf("offset after moving up = %d,%d, want 0,0", offsetRow, offsetWrap)
+	}
+}